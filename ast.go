@@ -0,0 +1,195 @@
+package tagex
+
+import "strings"
+
+// This file exposes the tag-value grammar as a syntax tree, for linters and
+// code generators that need to read or write tag values. Parse is built on the
+// same scanner the Tag compiles with, so the tree always matches what a Tag
+// sees; it needs no Tag, and checks syntax only: whether a name is a
+// registered directive or macro, and whether a condition names a real field,
+// is decided when a Tag compiles the value.
+
+// SegmentKind says what a Segment holds.
+type SegmentKind int
+
+const (
+	// DirectiveSegment is a directive or macro: Name and Args.
+	DirectiveSegment SegmentKind = iota
+	// GroupSegment is an element group (each, keys, values) or a combinator
+	// (any, all, not): Name and Chains.
+	GroupSegment
+	// ConditionSegment is when(...) or unless(...): Name, Cond, and one chain
+	// in Chains.
+	ConditionSegment
+)
+
+// Chain is a parsed tag value: its ';'-separated segments in order.
+type Chain struct {
+	// OmitEmpty is set when the chain starts with the omitempty modifier
+	// (omitempty or ?).
+	OmitEmpty bool
+	Segments  []Segment
+}
+
+// Segment is one segment of a Chain. Pos and End are its byte offsets in the
+// value passed to Parse, End exclusive, surrounding whitespace excluded.
+type Segment struct {
+	Kind SegmentKind
+	// Name is the directive or macro name, or the group, combinator, or
+	// condition keyword.
+	Name string
+	// Args are a DirectiveSegment's args in source order, values unquoted.
+	// A key given twice appears twice; the Tag uses the last.
+	Args []Arg
+	// Cond is a ConditionSegment's condition, as written.
+	Cond string
+	// Chains are the chains a GroupSegment or ConditionSegment holds: one per
+	// alternative for any, otherwise exactly one. An alternative of any is a
+	// single segment, so a chain in it has at most one Segment.
+	Chains []Chain
+
+	Pos, End int
+}
+
+// Arg is one arg of a directive segment: key=value, or a bare value with an
+// empty Key (a positional or flag arg). Value is unquoted. Pos and End are the
+// byte offsets of the whole arg in the value passed to Parse, and ValuePos
+// that of the value as written (its opening quote, if quoted).
+type Arg struct {
+	Key, Value string
+	Pos, End   int
+	ValuePos   int
+}
+
+// Parse parses a tag value into a Chain. It returns a *DirectiveParseError
+// for a segment with no name or an unclosed group, a *ParamParseError for an empty arg or a
+// malformed key=value pair, and a *ConditionParseError for a condition
+// without a ':', wherever in the value they occur. A *DirectiveParseError or
+// *ParamParseError carries its Position in tagValue.
+func Parse(tagValue string) (Chain, error) {
+	return parseChain(wholeSpan(tagValue))
+}
+
+func parseChain(s span) (Chain, error) {
+	var c Chain
+	segs, omit := cutOmitEmpty(s.chain())
+	c.OmitEmpty = omit
+	for _, seg := range segs {
+		sg, err := parseSegment(seg)
+		if err != nil {
+			return Chain{}, err
+		}
+		c.Segments = append(c.Segments, sg)
+	}
+	return c, nil
+}
+
+// parseSegment parses the trimmed segment seg.
+func parseSegment(seg span) (Segment, error) {
+	sg := Segment{Pos: seg.pos, End: seg.end()}
+	if op, inner, ok := seg.group(); ok && (isGroup(op) || isCombinator(op) || isCondition(op)) {
+		sg.Name = op
+		switch {
+		case isCondition(op):
+			sg.Kind = ConditionSegment
+			cond, rest, ok := inner.cutCondition()
+			if !ok {
+				return Segment{}, &ConditionParseError{
+					Condition: strings.TrimSpace(inner.text),
+					Reason:    "missing ':' between the condition and its chain",
+				}
+			}
+			sg.Cond = strings.TrimSpace(cond.text)
+			chain, err := parseChain(rest)
+			if err != nil {
+				return Segment{}, err
+			}
+			sg.Chains = []Chain{chain}
+		case op == combAny:
+			sg.Kind = GroupSegment
+			sg.Chains = []Chain{}
+			for _, alt := range inner.chain() {
+				chain, err := parseChain(alt)
+				if err != nil {
+					return Segment{}, err
+				}
+				sg.Chains = append(sg.Chains, chain)
+			}
+		default:
+			sg.Kind = GroupSegment
+			chain, err := parseChain(inner)
+			if err != nil {
+				return Segment{}, err
+			}
+			sg.Chains = []Chain{chain}
+		}
+		return sg, nil
+	}
+
+	name, args, err := parseDirective(seg)
+	if err != nil {
+		return Segment{}, err
+	}
+	sg.Kind = DirectiveSegment
+	sg.Name = name
+	sg.Args = args
+	return sg, nil
+}
+
+// String prints c in canonical form: one space after each ',' and ':' and
+// none elsewhere, the omitempty modifier as a leading ?, and arg values quoted
+// only when they must be. For a Chain returned by Parse, Parse(c.String())
+// returns the same Chain apart from offsets.
+func (c Chain) String() string {
+	var b strings.Builder
+	c.write(&b)
+	return b.String()
+}
+
+func (c Chain) write(b *strings.Builder) {
+	if c.OmitEmpty {
+		b.WriteByte('?')
+	}
+	for i, sg := range c.Segments {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		sg.write(b)
+	}
+}
+
+// String prints sg in canonical form, as Chain.String does.
+func (sg Segment) String() string {
+	var b strings.Builder
+	sg.write(&b)
+	return b.String()
+}
+
+func (sg Segment) write(b *strings.Builder) {
+	b.WriteString(sg.Name)
+	switch sg.Kind {
+	case DirectiveSegment:
+		for _, a := range sg.Args {
+			b.WriteString(", ")
+			if a.Key != "" {
+				b.WriteString(a.Key)
+				b.WriteByte('=')
+			}
+			b.WriteString(quoteValue(a.Value))
+		}
+		return
+	case ConditionSegment:
+		b.WriteByte('(')
+		b.WriteString(sg.Cond)
+		b.WriteString(": ")
+	default:
+		b.WriteByte('(')
+	}
+	for i, c := range sg.Chains {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		c.write(b)
+	}
+	b.WriteByte(')')
+}
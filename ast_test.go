@@ -0,0 +1,173 @@
+package tagex
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := "?trim; length, min=3, max='a,b';each(lower);any(x; all(y;z));when(Kind == draft: required)"
+	c, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !c.OmitEmpty || len(c.Segments) != 5 {
+		t.Fatalf("got %+v", c)
+	}
+
+	length := c.Segments[1]
+	if length.Kind != DirectiveSegment || length.Name != "length" {
+		t.Errorf("segment 1 = %+v", length)
+	}
+	wantArgs := []Arg{{Key: "min", Value: "3"}, {Key: "max", Value: "a,b"}}
+	for i, a := range length.Args {
+		if a.Key != wantArgs[i].Key || a.Value != wantArgs[i].Value {
+			t.Errorf("arg %d = %+v, want %+v", i, a, wantArgs[i])
+		}
+	}
+	if got := src[length.Args[1].Pos:length.Args[1].End]; got != "max='a,b'" {
+		t.Errorf("arg offsets cover %q", got)
+	}
+
+	any := c.Segments[3]
+	if any.Kind != GroupSegment || len(any.Chains) != 2 || any.Chains[1].Segments[0].Name != "all" {
+		t.Errorf("segment 3 = %+v", any)
+	}
+	cond := c.Segments[4]
+	if cond.Kind != ConditionSegment || cond.Cond != "Kind == draft" || cond.Chains[0].Segments[0].Name != "required" {
+		t.Errorf("segment 4 = %+v", cond)
+	}
+
+	// Offsets point back into the source, at every depth.
+	for _, sg := range []Segment{c.Segments[0], length, any.Chains[1].Segments[0].Chains[0].Segments[1], cond.Chains[0].Segments[0]} {
+		if got := src[sg.Pos:sg.End]; got != sg.String() {
+			t.Errorf("offsets of %q cover %q", sg.String(), got)
+		}
+	}
+
+	want := "?trim;length, min=3, max='a,b';each(lower);any(x;all(y;z));when(Kind == draft: required)"
+	if got := c.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		src    string
+		target any
+	}{
+		{"trim;, min=1", new(*DirectiveParseError)},
+		{"each(length, min=)", new(*ParamParseError)},
+		{"oneof, a, , b", new(*ParamParseError)},
+		{"any(a; b, =x)", new(*ParamParseError)},
+		{"when(Kind required)", new(*ConditionParseError)},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.src); !errors.As(err, tt.target) {
+			t.Errorf("Parse(%q) = %v, want %T", tt.src, err, tt.target)
+		}
+	}
+}
+
+// Only the parentheses of a group, condition, or combinator group: a tag
+// written before they did, with a '(' in a value, parses into the segments
+// and args it always had.
+func TestParse_PlainParens(t *testing.T) {
+	type seg struct {
+		name string
+		args map[string]string
+	}
+	tests := []struct {
+		src  string
+		want []seg
+	}{
+		{"contains, sub=(;trim", []seg{{"contains", map[string]string{"sub": "("}}, {"trim", map[string]string{}}}},
+		{"a, x=(, y=2", []seg{{"a", map[string]string{"x": "(", "y": "2"}}}},
+		{"regex, pattern=(a|b;trim", []seg{{"regex", map[string]string{"pattern": "(a|b"}}, {"trim", map[string]string{}}}},
+		{"note, text=any(, n=2", []seg{{"note", map[string]string{"text": "any(", "n": "2"}}}},
+		{"note, text=appears in (x", []seg{{"note", map[string]string{"text": "appears in (x"}}}},
+		{"note, text=a:any(b", []seg{{"note", map[string]string{"text": "a:any(b"}}}},
+		{"note, text=?each(b", []seg{{"note", map[string]string{"text": "?each(b"}}}},
+	}
+	for _, tt := range tests {
+		c, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", tt.src, err)
+			continue
+		}
+		var got []seg
+		for _, sg := range c.Segments {
+			got = append(got, seg{sg.Name, argMap(sg.Args)})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+// stripPos zeroes every offset in c, for comparing trees parsed from
+// different text.
+func stripPos(c Chain) Chain {
+	for i := range c.Segments {
+		sg := &c.Segments[i]
+		sg.Pos, sg.End = 0, 0
+		for j := range sg.Args {
+			sg.Args[j].Pos, sg.Args[j].End, sg.Args[j].ValuePos = 0, 0, 0
+		}
+		for j := range sg.Chains {
+			sg.Chains[j] = stripPos(sg.Chains[j])
+		}
+	}
+	return c
+}
+
+func checkPosition(t *testing.T, src string, p Position) {
+	t.Helper()
+	if p.Source != src || p.Offset < 0 || p.Offset+p.Len > len(src) || p.Segment < 0 {
+		t.Fatalf("Parse(%q): bad Position %+v", src, p)
+	}
+}
+
+// FuzzParse: Parse never panics, and a parse error's Position lies within the
+// source. Whatever Parse accepts prints to a canonical form that parses back
+// to the same tree and prints identically.
+func FuzzParse(f *testing.F) {
+	for _, s := range []string{
+		"trim;length, min=3, max=20",
+		"regex, pattern='\\d{1,3}'",
+		"?each(trim;lower)",
+		"omitempty;any(a; all(b;c)); not(x, v='it''s')",
+		"when(Country in (DE, 'N,L'): required)",
+		"k, a='', b=' x '",
+		"f(x), v=(",
+		"??a;;",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		c, err := Parse(src)
+		var pp *ParamParseError
+		var dp *DirectiveParseError
+		switch {
+		case errors.As(err, &pp):
+			checkPosition(t, src, pp.Position)
+		case errors.As(err, &dp):
+			checkPosition(t, src, dp.Position)
+		}
+		if err != nil {
+			return
+		}
+		printed := c.String()
+		again, err := Parse(printed)
+		if err != nil {
+			t.Fatalf("Parse(%q) ok, but its String %q fails: %v", src, printed, err)
+		}
+		if !reflect.DeepEqual(stripPos(c), stripPos(again)) {
+			t.Fatalf("Parse(%q) and Parse(%q) differ:\n%+v\n%+v", src, printed, c, again)
+		}
+		if s := again.String(); s != printed {
+			t.Fatalf("String not canonical: %q then %q", printed, s)
+		}
+	})
+}
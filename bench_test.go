@@ -115,3 +115,18 @@ func BenchmarkProcessStruct_Failure(b *testing.B) {
 		_ = valTag.ProcessStruct(&data)
 	}
 }
+
+type benchVariables struct {
+	Label string `val:"length, min=1, max=${maxLen}"`
+}
+
+func BenchmarkProcessStruct_Variables(b *testing.B) {
+	valTag, _ := setupBenchTags()
+	valTag.SetVariable("maxLen", "10")
+	data := benchVariables{Label: "ok"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = valTag.ProcessStruct(&data)
+	}
+}
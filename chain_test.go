@@ -1,6 +1,7 @@
 package tagex
 
 import (
+	"context"
 	"reflect"
 	"strings"
 	"testing"
@@ -92,3 +93,9 @@ func TestProcessDirective_ChainSkipsEmptySegments(t *testing.T) {
 		t.Errorf("expected %q, got %q", "ab", s)
 	}
 }
+
+// processDirective compiles tagValue afresh and runs it on fieldValue, the way
+// ProcessStruct runs a field's chain from the Tag's cached plan.
+func processDirective(tag *Tag, tagValue string, fieldValue reflect.Value) error {
+	return compileChain(tag, wholeSpan(tagValue), fieldValue.Type(), nil).run(context.Background(), fieldValue, &FieldInfo{TagKey: tag.Key})
+}
@@ -0,0 +1,151 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// This file compiles the logical combinators:
+//
+//	any(email;phone)           passes if one alternative passes
+//	all(trim;length, min=3)    passes if the whole chain passes
+//	not(oneof, values=admin)   passes if the chain fails
+//
+// Inside any(...) each ';' segment is one alternative, so an alternative made
+// of several directives is written as all(...). all is otherwise an ordinary
+// chain, which makes it the grouping construct for any and not.
+
+// Combinator names.
+const (
+	combAny = "any"
+	combAll = "all"
+	combNot = "not"
+)
+
+func isCombinator(op string) bool {
+	return op == combAny || op == combAll || op == combNot
+}
+
+// combPlan is a compiled combinator. For any, alts holds one chain per
+// alternative; for all and not, it holds the single inner chain. text is the
+// source of the inner chain, for NegationError.
+type combPlan struct {
+	op   string
+	alts []chainPlan
+	text string
+}
+
+func compileCombinator(tag *Tag, op string, inner span, typ, parent reflect.Type) *combPlan {
+	c := &combPlan{op: op, text: strings.TrimSpace(inner.text)}
+	if op != combAny {
+		c.alts = []chainPlan{compileChain(tag, inner, typ, parent)}
+		return c
+	}
+	for _, seg := range inner.chain() {
+		c.alts = append(c.alts, compileChain(tag, seg, typ, parent))
+	}
+	return c
+}
+
+func (c *combPlan) run(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	switch c.op {
+	case combAll:
+		return c.alts[0].run(ctx, val, field)
+	case combNot:
+		// The chain runs on a copy: a not(...) never mutates.
+		err := c.alts[0].run(ctx, copyValue(val), field)
+		if err != nil {
+			if rejected(err) {
+				return nil
+			}
+			return err
+		}
+		return &ProcessError{
+			Stage:     StageDirective,
+			Directive: combNot,
+			Cause:     &NegationError{Chain: c.text},
+		}
+	}
+
+	// any: each alternative runs on its own copy, so a failed alternative's
+	// MutMode writes are discarded; the first to pass is stored back.
+	errs := make([]error, 0, len(c.alts))
+	for _, alt := range c.alts {
+		tmp := copyValue(val)
+		err := alt.run(ctx, tmp, field)
+		if err == nil {
+			if val.CanSet() {
+				val.Set(tmp)
+			}
+			return nil
+		}
+		if !rejected(err) {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil // any() with no alternatives
+	}
+	return &ProcessError{
+		Stage:     StageDirective,
+		Directive: combAny,
+		Cause:     &AnyError{Errs: errs},
+	}
+}
+
+// rejected reports whether err means a directive rejected the value, as
+// opposed to a fault in the tag or its wiring (an unknown directive, a missing
+// param, a type mismatch) or a cancelled context. Only a rejection counts as a
+// failed alternative of any(...) or a passing not(...); anything else is
+// returned as is, so a broken tag never passes by accident.
+func rejected(err error) bool {
+	var he *HandleError
+	var ne *NegationError
+	return errors.As(err, &he) || errors.As(err, &ne)
+}
+
+// copyValue returns an addressable copy of val. Slices, arrays, and maps are
+// copied deeply, so a write to an element of the copy, such as an each(...)
+// inside the chain makes, doesn't reach val; anything behind a pointer is
+// still shared.
+func copyValue(val reflect.Value) reflect.Value {
+	c := reflect.New(val.Type()).Elem()
+	c.Set(deepCopy(val))
+	return c
+}
+
+// deepCopy returns val with its slices, arrays, and maps, however nested,
+// copied.
+func deepCopy(val reflect.Value) reflect.Value {
+	switch val.Kind() {
+	case reflect.Slice:
+		if val.IsNil() {
+			return val
+		}
+		c := reflect.MakeSlice(val.Type(), val.Len(), val.Len())
+		for i := 0; i < val.Len(); i++ {
+			c.Index(i).Set(deepCopy(val.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(val.Type()).Elem()
+		for i := 0; i < val.Len(); i++ {
+			c.Index(i).Set(deepCopy(val.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if val.IsNil() {
+			return val
+		}
+		c := reflect.MakeMapWithSize(val.Type(), val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	}
+	return val
+}
@@ -0,0 +1,142 @@
+package tagex
+
+import (
+	"errors"
+	"testing"
+)
+
+type contactForm struct {
+	// A 2-letter code, or a 10-12 character number once trimmed.
+	Contact string `val:"any(length, min=2, max=2; all(trim;length, min=10, max=12))"`
+}
+
+func TestAny_FirstPassingAlternativeWins(t *testing.T) {
+	tag := eachTag(t)
+	for _, in := range []string{"DE", " 0612345678 "} {
+		f := contactForm{Contact: in}
+		if err := tag.ProcessStruct(&f); err != nil {
+			t.Errorf("%q: unexpected error: %v", in, err)
+		}
+	}
+
+	// The passing alternative's MutMode writes are kept.
+	f := contactForm{Contact: " 0612345678 "}
+	_ = tag.ProcessStruct(&f)
+	if f.Contact != "0612345678" {
+		t.Errorf("Contact = %q, want the trimmed value", f.Contact)
+	}
+}
+
+func TestAny_ReportsEveryAlternative(t *testing.T) {
+	err := eachTag(t).ProcessStruct(&contactForm{Contact: "abc"})
+
+	var pe *ProcessError
+	if !errors.As(err, &pe) || pe.Directive != "any" || pe.FieldPath != "Contact" {
+		t.Fatalf("want any failure at Contact, got %v", err)
+	}
+	var ae *AnyError
+	if !errors.As(err, &ae) || len(ae.Errs) != 2 {
+		t.Fatalf("want an *AnyError with 2 alternatives, got %v", err)
+	}
+	for i, alt := range ae.Errs {
+		var ape *ProcessError
+		if !errors.As(alt, &ape) || ape.Directive != "length" {
+			t.Errorf("alternative %d: want a length failure, got %v", i+1, alt)
+		}
+	}
+}
+
+// A failed alternative's MutMode writes don't leak into the value.
+func TestAny_FailedAlternativeDiscarded(t *testing.T) {
+	type form struct {
+		S string `val:"any(all(lower;length, min=0, max=2); length, min=0, max=10)"`
+	}
+	f := form{S: "HELLO"}
+	if err := eachTag(t).ProcessStruct(&f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.S != "HELLO" {
+		t.Errorf("S = %q, want it untouched", f.S)
+	}
+}
+
+// Alternatives and not(...) run on deep copies: an each(...) that writes an
+// element and then fails leaves the collection untouched.
+func TestCombinator_CollectionWritesDiscarded(t *testing.T) {
+	type form struct {
+		L []string          `val:"any(each(lower;length, min=0, max=1); each(length, min=0, max=5))"`
+		M map[string]string `val:"any(values(lower;length, min=0, max=1); values(length, min=0, max=5))"`
+		N []string          `val:"not(each(lower;length, min=0, max=1))"`
+		A [2]string         `val:"not(each(lower;length, min=0, max=1))"`
+	}
+	f := form{L: []string{"AB", "c"}, M: map[string]string{"k": "AB"}, N: []string{"AB"}, A: [2]string{"AB", "c"}}
+	if err := eachTag(t).ProcessStruct(&f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.L[0] != "AB" || f.M["k"] != "AB" || f.N[0] != "AB" || f.A[0] != "AB" {
+		t.Errorf("failed chains leaked their writes: %+v", f)
+	}
+}
+
+func TestNot(t *testing.T) {
+	type form struct {
+		S string `val:"not(all(lower;length, min=0, max=0))"`
+	}
+	tag := eachTag(t)
+
+	f := form{S: "ABC"}
+	if err := tag.ProcessStruct(&f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.S != "ABC" {
+		t.Errorf("S = %q: not(...) must not mutate", f.S)
+	}
+
+	err := tag.ProcessStruct(&form{})
+	var ne *NegationError
+	if !errors.As(err, &ne) || ne.Chain != "all(lower;length, min=0, max=0)" {
+		t.Fatalf("want a *NegationError, got %v", err)
+	}
+}
+
+// Quoting still wins inside a combinator: the ';' in the pattern doesn't split
+// the alternative, and a quoted "any(" is a plain value.
+func TestAny_RespectsQuoting(t *testing.T) {
+	var seen string
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &rxCapture{seen: &seen})
+
+	type a struct {
+		S string `val:"any(regex, pattern='x;y)')"`
+	}
+	type b struct {
+		S string `val:"regex, pattern='any(a;b)'"`
+	}
+	if err := tag.ProcessStruct(&a{}); err != nil || seen != "x;y)" {
+		t.Errorf("in any: seen %q, err %v", seen, err)
+	}
+	if err := tag.ProcessStruct(&b{}); err != nil || seen != "any(a;b)" {
+		t.Errorf("quoted: seen %q, err %v", seen, err)
+	}
+}
+
+// A broken tag inside a combinator is reported, never taken for a rejection
+// that any(...) could skip or not(...) could invert.
+func TestCombinator_TagFaultsPropagate(t *testing.T) {
+	type anyForm struct {
+		S string `val:"any(nosuch; length, min=0, max=10)"`
+	}
+	type notForm struct {
+		S string `val:"not(length, max=1)"`
+	}
+	tag := eachTag(t)
+
+	var ue *UnknownDirectiveError
+	if err := tag.ProcessStruct(&anyForm{}); !errors.As(err, &ue) {
+		t.Errorf("any: want an *UnknownDirectiveError, got %v", err)
+	}
+	var me *MissingParamError
+	if err := tag.ProcessStruct(&notForm{}); !errors.As(err, &me) {
+		t.Errorf("not: want a *MissingParamError, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// This file compiles conditional segments:
+//
+//	when(Country in (DE, FR, NL): required)
+//	unless(Kind == draft: length, min=10)
+//
+// The text before the first top-level ':' is a predicate on a sibling field;
+// the rest is an ordinary chain that runs only when the predicate holds (when)
+// or doesn't (unless). A predicate is one of
+//
+//	Field               Field is non-zero
+//	Field == value      Field equals value
+//	Field != value      Field differs from value
+//	Field in (a, b)     Field equals one of the listed values
+//
+// and a leading '!' negates it ("!Field" is "Field is zero"). Only a field of a
+// comparable type takes ==, !=, or in; a slice or map field can only be tested
+// for zero. Values follow the usual quoting rules, so a value holding ',', ':',
+// or ')' is single-quoted.
+// Field paths are resolved like FieldRef paths, against the struct holding the
+// tagged field, when the plan is compiled.
+
+// Conditional segment names.
+const (
+	condWhen   = "when"
+	condUnless = "unless"
+)
+
+func isCondition(op string) bool {
+	return op == condWhen || op == condUnless
+}
+
+// condPlan is a compiled when(...) or unless(...) segment. err is set when the
+// predicate doesn't parse or names no field.
+type condPlan struct {
+	op    string
+	pred  predicate
+	chain chainPlan
+	err   *ProcessError
+}
+
+// predicate is a compiled condition on a sibling field.
+type predicate struct {
+	not bool
+	ref FieldRef
+	op  string // "" (non-zero), "==", "!=", or "in"
+
+	// values holds the comparison literals converted to the field's type.
+	// Literals for a type DefaultConvert can't produce are kept in raw and
+	// compared against the field's fmt.Sprint form instead.
+	values []reflect.Value
+	raw    []string
+}
+
+// compileCondition compiles "pred: chain" for a field of the struct type
+// parent; typ is the field's type, handed on to the chain.
+func compileCondition(tag *Tag, op string, inner span, typ, parent reflect.Type) *condPlan {
+	cond, rest, ok := inner.cutCondition()
+	if !ok {
+		return condError(op, &ConditionParseError{
+			Condition: strings.TrimSpace(inner.text),
+			Reason:    "missing ':' between the condition and its chain",
+		})
+	}
+	pred, err := parsePredicate(cond.text, parent)
+	if err != nil {
+		return condError(op, err)
+	}
+	return &condPlan{op: op, pred: pred, chain: compileChain(tag, rest, typ, parent)}
+}
+
+func condError(op string, err error) *condPlan {
+	return &condPlan{op: op, err: &ProcessError{
+		Stage:     StageDirective,
+		Directive: op,
+		Cause:     err,
+	}}
+}
+
+// parsePredicate parses and resolves a predicate against the struct type
+// parent.
+func parsePredicate(text string, parent reflect.Type) (predicate, error) {
+	text = strings.TrimSpace(text)
+	fail := func(reason string, err error) (predicate, error) {
+		return predicate{}, &ConditionParseError{Condition: text, Reason: reason, Err: err}
+	}
+
+	var p predicate
+	s := text
+	if strings.HasPrefix(s, "!") && !strings.HasPrefix(s, "!=") {
+		p.not = true
+		s = strings.TrimSpace(s[1:])
+	}
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '.' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	name, rest := s[:end], strings.TrimSpace(s[end:])
+	if name == "" {
+		return fail("missing field name", nil)
+	}
+	if parent == nil {
+		return fail("no enclosing struct to resolve "+name+" against", nil)
+	}
+	index, ftyp, err := resolveField(parent, name)
+	if err != nil {
+		return fail("unknown field", err)
+	}
+	p.ref = FieldRef{Path: name, index: index}
+
+	var lits []string
+	switch {
+	case rest == "":
+		return p, nil
+	case strings.HasPrefix(rest, "=="), strings.HasPrefix(rest, "!="):
+		p.op = rest[:2]
+		v := strings.TrimSpace(rest[2:])
+		if v == "" {
+			return fail("missing value after "+p.op, nil)
+		}
+		lits = []string{unquote(v)}
+	case strings.HasPrefix(rest, "in"):
+		p.op = "in"
+		list := strings.TrimSpace(rest[2:])
+		if len(list) < 2 || list[0] != '(' || list[len(list)-1] != ')' {
+			return fail("expected a parenthesised list after in", nil)
+		}
+		for _, v := range splitTopN(list[1:len(list)-1], ',', -1) {
+			if strings.TrimSpace(v) == "" {
+				return fail("empty value in list", nil)
+			}
+			lits = append(lits, unquote(v))
+		}
+	default:
+		return fail(fmt.Sprintf("unknown operator in %q", rest), nil)
+	}
+
+	for ftyp.Kind() == reflect.Ptr {
+		ftyp = ftyp.Elem()
+	}
+	if !ftyp.Comparable() {
+		return fail(fmt.Sprintf("%s can't be compared with %s", ftyp, p.op), nil)
+	}
+	for _, lit := range lits {
+		v := reflect.New(ftyp).Elem()
+		err := DefaultConvert(v, lit, "")
+		var unsupported *UnsupportedParamTypeError
+		switch {
+		case errors.As(err, &unsupported):
+			p.raw = append(p.raw, lit)
+		case err != nil:
+			return fail(fmt.Sprintf("%q is not a valid %s", lit, ftyp), nil)
+		default:
+			p.values = append(p.values, v)
+		}
+	}
+	return p, nil
+}
+
+// eval reports whether the predicate holds for the struct field belongs to.
+// A field behind a nil pointer counts as zero and equals nothing.
+func (p *predicate) eval(field *FieldInfo) bool {
+	v := p.ref.Value(*field)
+	var ok bool
+	if p.op == "" {
+		ok = v.IsValid() && !v.IsZero()
+	} else {
+		ok = p.matches(v)
+		if p.op == "!=" {
+			ok = !ok
+		}
+	}
+	return ok != p.not
+}
+
+// matches reports whether v equals one of the predicate's literals.
+func (p *predicate) matches(v reflect.Value) bool {
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return false
+	}
+	for _, lit := range p.values {
+		if v.Equal(lit) {
+			return true
+		}
+	}
+	if len(p.raw) > 0 {
+		s := fmt.Sprint(v.Interface())
+		for _, lit := range p.raw {
+			if s == lit {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// run runs c's chain on val when its predicate selects it.
+func (c *condPlan) run(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	if c.err != nil {
+		e := *c.err
+		return &e
+	}
+	if c.pred.eval(field) != (c.op == condWhen) {
+		return nil
+	}
+	return c.chain.run(ctx, val, field)
+}
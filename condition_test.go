@@ -0,0 +1,142 @@
+package tagex
+
+import (
+	"errors"
+	"testing"
+)
+
+type requiredDirective struct{}
+
+func (d *requiredDirective) Name() string        { return "required" }
+func (d *requiredDirective) Mode() DirectiveMode { return EvalMode }
+func (d *requiredDirective) Handle(val string) (string, error) {
+	if val == "" {
+		return val, errors.New("is required")
+	}
+	return val, nil
+}
+
+func condTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := eachTag(t)
+	MustRegisterDirective(tag, &requiredDirective{})
+	return tag
+}
+
+type kind string
+
+type invoice struct {
+	Country   string
+	Kind      kind
+	Lines     int
+	Reviewer  *string
+	VATNumber string `val:"when(Country in (DE, FR, 'N,L'): required)"`
+	Summary   string `val:"unless(Kind == draft: length, min=3, max=20)"`
+	Notes     string `val:"when(Lines != 0: required)"`
+	Sign      string `val:"when(!Reviewer: required)"`
+	Approval  string `val:"when(Reviewer: required)"`
+}
+
+func TestCondition_Predicates(t *testing.T) {
+	reviewer := "ann"
+	ok := invoice{Kind: "draft", Country: "US", Reviewer: &reviewer, Approval: "y"}
+	tests := []struct {
+		name string
+		edit func(*invoice)
+		want string // failing field, "" for none
+	}{
+		{"all skipped", func(*invoice) {}, ""},
+		{"in matches", func(i *invoice) { i.Country = "FR" }, "VATNumber"},
+		{"quoted list value", func(i *invoice) { i.Country = "N,L" }, "VATNumber"},
+		{"equality skips unless", func(i *invoice) { i.Kind = "final" }, "Summary"},
+		{"not equal", func(i *invoice) { i.Lines = 2 }, "Notes"},
+		{"negated zero", func(i *invoice) { i.Reviewer = nil; i.Approval = "" }, "Sign"},
+		{"non-zero", func(i *invoice) { i.Approval = "" }, "Approval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := ok
+			tt.edit(&inv)
+			err := condTag(t).ProcessStruct(&inv)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var pe *ProcessError
+			if !errors.As(err, &pe) || pe.FieldPath != tt.want {
+				t.Fatalf("want failure at %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// The chain after ':' is a full chain: MutMode, groups, and nesting all work.
+func TestCondition_ChainMutates(t *testing.T) {
+	type post struct {
+		Draft bool
+		Tags  []string `val:"unless(Draft: each(trim;lower))"`
+	}
+	p := post{Tags: []string{" A "}}
+	if err := condTag(t).ProcessStruct(&p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Tags[0] != "a" {
+		t.Errorf("Tags[0] = %q, want %q", p.Tags[0], "a")
+	}
+}
+
+func TestCondition_ParseErrors(t *testing.T) {
+	type unknown struct {
+		VAT string `val:"when(Countryy == DE: required)"`
+	}
+	type noColon struct {
+		VAT string `val:"when(Country == DE)"`
+	}
+	type badValue struct {
+		Lines int
+		VAT   string `val:"when(Lines == many: required)"`
+	}
+	type badOp struct {
+		Lines int
+		VAT   string `val:"when(Lines > 2: required)"`
+	}
+	type sliceField struct {
+		Tags []string
+		VAT  string `val:"when(Tags == a: required)"`
+	}
+	type mapField struct {
+		Attrs map[string]int
+		VAT   string `val:"when(Attrs in ('a=1', 'b=2'): required)"`
+	}
+	tests := []struct {
+		name string
+		data any
+	}{
+		{"unknown field", &unknown{}},
+		{"missing colon", &noColon{}},
+		{"value of wrong type", &badValue{}},
+		{"unknown operator", &badOp{}},
+		{"slice field", &sliceField{Tags: []string{"a"}}},
+		{"map field", &mapField{Attrs: map[string]int{"a": 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := condTag(t).ProcessStruct(tt.data)
+			var ce *ConditionParseError
+			if !errors.As(err, &ce) {
+				t.Fatalf("expected *ConditionParseError, got %v", err)
+			}
+			var pe *ProcessError
+			if errors.As(err, &pe); pe.Stage != StageDirective || pe.Directive != "when" {
+				t.Errorf("Stage = %v, Directive = %q", pe.Stage, pe.Directive)
+			}
+		})
+	}
+
+	var re *FieldRefError
+	if err := condTag(t).ProcessStruct(&unknown{}); !errors.As(err, &re) {
+		t.Errorf("unknown field: expected a wrapped *FieldRefError, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package tagex
+
+import (
+	"cmp"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This file implements constraints on param values, declared in the param tag
+// next to required and default:
+//
+//	Mode  string `param:"mode, oneof='left,right,both'"`
+//	Min   int    `param:"min, min=0"`
+//	Width int    `param:"width, min=1, max=80"`
+//	Unit  string `param:"unit, pattern='[a-z]+'"`
+//
+// oneof and pattern check each raw value as written, before conversion: a
+// variadic param's every element. min and max check the converted field: a
+// number against the bound, and a string, slice, or map by its length. A
+// violation is a *ParamConstraintError. Checks across params, such as min <=
+// max, belong in a ParamValidator.
+
+// ParamValidator is an optional interface for directives whose params must be
+// checked together. ValidateParams runs once all params are applied and their
+// constraints hold; an error it returns is reported at StageParam. Return a
+// *ParamConstraintError to name the param at fault:
+//
+//	func (d *RangeDirective) ValidateParams() error {
+//		if d.Min > d.Max {
+//			return &tagex.ParamConstraintError{Param: "min", Value: strconv.Itoa(d.Min), Constraint: "min <= max"}
+//		}
+//		return nil
+//	}
+type ParamValidator interface {
+	ValidateParams() error
+}
+
+// constraints are the value constraints of a param tag.
+type constraints struct {
+	oneof    []string
+	min, max *string
+	pattern  *regexp.Regexp
+	patText  string // pattern as written
+}
+
+// parseConstraints reads the constraint options of the param name from the
+// param tag args.
+func parseConstraints(name string, args map[string]string) (constraints, error) {
+	var c constraints
+	if raw, ok := args["oneof"]; ok {
+		elems, err := splitList(raw, name, reflect.TypeFor[[]string]())
+		if err != nil || len(elems) == 0 {
+			return c, &ConversionError{Param: name, Raw: raw, Target: "list of values"}
+		}
+		for _, e := range elems {
+			c.oneof = append(c.oneof, unquote(e))
+		}
+	}
+	if raw, ok := args["min"]; ok {
+		c.min = &raw
+	}
+	if raw, ok := args["max"]; ok {
+		c.max = &raw
+	}
+	if raw, ok := args["pattern"]; ok {
+		re, err := regexp.Compile(`^(?:` + raw + `)$`)
+		if err != nil {
+			return c, &ConversionError{Param: name, Raw: raw, Target: "regexp", Err: err}
+		}
+		c.pattern, c.patText = re, raw
+	}
+	return c, nil
+}
+
+// checkDeclaration checks that min and max suit a field of type typ, and that
+// min is not above max.
+func (c constraints) checkDeclaration(name string, typ reflect.Type) error {
+	var lo, hi reflect.Value
+	for _, b := range []struct {
+		raw *string
+		dst *reflect.Value
+	}{{c.min, &lo}, {c.max, &hi}} {
+		if b.raw == nil {
+			continue
+		}
+		v, err := boundValue(name, typ, *b.raw)
+		if err != nil {
+			return err
+		}
+		*b.dst = v
+	}
+	if lo.IsValid() && hi.IsValid() && compareMeasures(lo, hi) > 0 {
+		return &ParamConflictError{Param: name, Reason: "min is above max"}
+	}
+	return nil
+}
+
+// checkRaw checks raw, a value given for the param name, against oneof and
+// pattern.
+func (c constraints) checkRaw(name, raw string) error {
+	if c.oneof != nil && !contains(c.oneof, raw) {
+		return &ParamConstraintError{Param: name, Value: raw, Constraint: "oneof=" + strings.Join(c.oneof, ",")}
+	}
+	if c.pattern != nil && !c.pattern.MatchString(raw) {
+		return &ParamConstraintError{Param: name, Value: raw, Constraint: "pattern=" + c.patText}
+	}
+	return nil
+}
+
+// checkBounds checks v, the converted value of the param name, against min
+// and max. raw is the value as given, for the error.
+func (c constraints) checkBounds(name string, v reflect.Value, raw string) error {
+	if c.min == nil && c.max == nil {
+		return nil
+	}
+	m := measure(v)
+	if c.min != nil {
+		if lo, err := boundValue(name, v.Type(), *c.min); err != nil {
+			return err
+		} else if compareMeasures(m, lo) < 0 {
+			return &ParamConstraintError{Param: name, Value: raw, Constraint: "min=" + *c.min}
+		}
+	}
+	if c.max != nil {
+		if hi, err := boundValue(name, v.Type(), *c.max); err != nil {
+			return err
+		} else if compareMeasures(m, hi) > 0 {
+			return &ParamConstraintError{Param: name, Value: raw, Constraint: "max=" + *c.max}
+		}
+	}
+	return nil
+}
+
+// boundValue parses raw, a min or max of the param name, as the measure of a
+// value of type typ: a value of typ itself for a number (so a time.Duration
+// bound reads "1s"), else an int length.
+func boundValue(name string, typ reflect.Type, raw string) (reflect.Value, error) {
+	switch typ.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return reflect.Value{}, &ConversionError{Param: name, Raw: raw, Target: "int"}
+		}
+		return reflect.ValueOf(n), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		v := reflect.New(typ).Elem()
+		if err := DefaultConvert(v, raw, name); err != nil {
+			return reflect.Value{}, err
+		}
+		return v, nil
+	}
+	return reflect.Value{}, &ParamConflictError{Param: name, Reason: "min and max need a number, string, slice, or map field"}
+}
+
+// measure returns what min and max compare v by: its length, or v itself.
+func measure(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return reflect.ValueOf(v.Len())
+	}
+	return v
+}
+
+// compareMeasures compares two measures of the same kind.
+func compareMeasures(a, b reflect.Value) int {
+	switch {
+	case a.CanInt():
+		return cmp.Compare(a.Int(), b.Int())
+	case a.CanUint():
+		return cmp.Compare(a.Uint(), b.Uint())
+	}
+	return cmp.Compare(a.Float(), b.Float())
+}
@@ -0,0 +1,154 @@
+package tagex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// alignDirective pads a value to Width on the side Side names.
+type alignDirective struct {
+	Side  string   `param:"side, oneof='left,right'"`
+	Width int      `param:"width, min=1, max=80"`
+	Fill  string   `param:"fill, default=' ', pattern='.'"`
+	Tags  []string `param:"tags, variadic, max=2, pattern='[a-z]+'"`
+}
+
+func (d *alignDirective) Name() string        { return "align" }
+func (d *alignDirective) Mode() DirectiveMode { return MutMode }
+func (d *alignDirective) Handle(val string) (string, error) {
+	pad := strings.Repeat(d.Fill, max(0, d.Width-len(val)))
+	if d.Side == "left" {
+		return val + pad, nil
+	}
+	return pad + val, nil
+}
+
+// spanDirective checks its params together.
+type spanDirective struct {
+	From time.Duration `param:"from, min=0s"`
+	To   time.Duration `param:"to"`
+}
+
+func (d *spanDirective) Name() string                      { return "span" }
+func (d *spanDirective) Mode() DirectiveMode               { return EvalMode }
+func (d *spanDirective) Handle(val string) (string, error) { return val, nil }
+func (d *spanDirective) ValidateParams() error {
+	if d.From > d.To {
+		return &ParamConstraintError{Param: "from", Value: d.From.String(), Constraint: "from <= to"}
+	}
+	return nil
+}
+
+func constraintTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &alignDirective{})
+	MustRegisterDirective(tag, &spanDirective{})
+	return tag
+}
+
+func TestParamConstraints(t *testing.T) {
+	type form struct {
+		S string `val:"align, side=right, width=4, fill=0, ab, cd"`
+		T string `val:"span, from=1s, to=1m"`
+	}
+	f := form{S: "7"}
+	if err := constraintTag(t).ProcessStruct(&f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.S != "0007" {
+		t.Errorf("got %q", f.S)
+	}
+}
+
+func TestParamConstraints_Violations(t *testing.T) {
+	tests := []struct {
+		value      any
+		param      string
+		constraint string
+	}{
+		{&struct {
+			S string `val:"align, side=up, width=4"`
+		}{}, "side", "oneof=left,right"},
+		{&struct {
+			S string `val:"align, side=left, width=0"`
+		}{}, "width", "min=1"},
+		{&struct {
+			S string `val:"align, side=left, width=81"`
+		}{}, "width", "max=80"},
+		{&struct {
+			S string `val:"align, side=left, width=4, fill=ab"`
+		}{}, "fill", "pattern=."},
+		{&struct {
+			S string `val:"align, side=left, width=4, ab, C"`
+		}{}, "tags", "pattern=[a-z]+"},
+		{&struct {
+			S string `val:"align, side=left, width=4, ab, cd, ef"`
+		}{}, "tags", "max=2"},
+		{&struct {
+			S string `val:"span, from=-1s, to=1s"`
+		}{}, "from", "min=0s"},
+		{&struct {
+			S string `val:"span, from=1m, to=1s"`
+		}{}, "from", "from <= to"},
+	}
+	for _, tt := range tests {
+		err := constraintTag(t).ProcessStruct(tt.value)
+		var pe *ProcessError
+		if !errors.As(err, &pe) || pe.Stage != StageParam || pe.Param != tt.param {
+			t.Errorf("want a StageParam failure of param %q, got %v", tt.param, err)
+			continue
+		}
+		var ce *ParamConstraintError
+		if !errors.As(err, &ce) || ce.Constraint != tt.constraint {
+			t.Errorf("want a *ParamConstraintError for %s, got %v", tt.constraint, err)
+		}
+	}
+}
+
+func TestParamConstraints_Declarations(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   any
+		target any
+	}{
+		{"min above max", &struct {
+			N int `param:"n, min=5, max=1"`
+		}{}, new(*ParamConflictError)},
+		{"bound on a bool", &struct {
+			B bool `param:"b, min=1"`
+		}{}, new(*ParamConflictError)},
+		{"bad bound", &struct {
+			N uint8 `param:"n, max=300"`
+		}{}, new(*ConversionError)},
+		{"bad pattern", &struct {
+			S string `param:"s, pattern='('"`
+		}{}, new(*ConversionError)},
+		{"empty oneof", &struct {
+			S string `param:"s, oneof=''"`
+		}{}, new(*ConversionError)},
+	}
+	for _, tt := range tests {
+		if err := ProcessParams(tt.data, map[string]string{}); !errors.As(err, tt.target) {
+			t.Errorf("%s: want %T, got %v", tt.name, tt.target, err)
+		}
+	}
+}
+
+// ProcessParams checks constraints and runs ValidateParams without a Tag.
+func TestProcessParams_Constraints(t *testing.T) {
+	var d spanDirective
+	err := ProcessParams(&d, map[string]string{"from": "2s", "to": "1s"})
+	var ce *ParamConstraintError
+	if !errors.As(err, &ce) || ce.Param != "from" {
+		t.Fatalf("want a *ParamConstraintError for from, got %v", err)
+	}
+	if got, want := err.Error(), `"from" param value "2s" violates from <= to`; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if err := ProcessParams(&d, map[string]string{"from": "1s", "to": "0s"}); err == nil {
+		t.Error("want from=1s, to=0s to fail")
+	}
+}
@@ -0,0 +1,186 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type ctxKey struct{}
+
+// uniqueDirective stands in for a directive doing I/O: it reads a value from
+// ctx and fails once ctx is done.
+type uniqueDirective struct {
+	seen *[]any
+}
+
+func (d *uniqueDirective) Name() string        { return "unique" }
+func (d *uniqueDirective) Mode() DirectiveMode { return EvalMode }
+func (d *uniqueDirective) HandleContext(ctx context.Context, val string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return val, err
+	}
+	*d.seen = append(*d.seen, ctx.Value(ctxKey{}))
+	return val, nil
+}
+
+func TestProcessStructContext_PassesContext(t *testing.T) {
+	var seen []any
+	tag := NewTag(valTagKey)
+	MustRegisterContextDirective(tag, &uniqueDirective{seen: &seen})
+
+	type user struct {
+		Email string `val:"unique"`
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req-1")
+	if err := tag.ProcessStructContext(ctx, &user{Email: "a@b"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "req-1" {
+		t.Errorf("directive saw %v, want [req-1]", seen)
+	}
+
+	// Without a context the directive still runs, with context.Background.
+	if err := tag.ProcessStruct(&user{Email: "a@b"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seen) != 2 || seen[1] != nil {
+		t.Errorf("directive saw %v, want [req-1 <nil>]", seen)
+	}
+}
+
+// A Directive[T] that also has HandleContext is called through HandleContext.
+type bothDirective struct{ viaCtx *bool }
+
+func (d *bothDirective) Name() string                      { return "both" }
+func (d *bothDirective) Mode() DirectiveMode               { return EvalMode }
+func (d *bothDirective) Handle(val string) (string, error) { return val, nil }
+func (d *bothDirective) HandleContext(_ context.Context, val string) (string, error) {
+	*d.viaCtx = true
+	return val, nil
+}
+
+func TestProcessStructContext_PrefersHandleContext(t *testing.T) {
+	var viaCtx bool
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &bothDirective{viaCtx: &viaCtx})
+
+	type form struct {
+		S string `val:"both"`
+	}
+	if err := tag.ProcessStructContext(context.Background(), &form{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !viaCtx {
+		t.Error("expected HandleContext to be called")
+	}
+}
+
+func TestProcessStructContext_CancelledStopsWalk(t *testing.T) {
+	tag := NewTag("mul")
+	MustRegisterDirective(tag, &MultiplyDirective{})
+
+	type item struct {
+		N int `mul:"mul, factor=2"`
+	}
+	type outer struct {
+		Items []item
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	o := outer{Items: []item{{N: 1}, {N: 2}}}
+	err := tag.ProcessStructContext(ctx, &o)
+
+	var pe *ProcessError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *ProcessError, got %v", err)
+	}
+	if pe.Stage != StageStruct {
+		t.Errorf("stage = %q, want %q", pe.Stage, StageStruct)
+	}
+	var ce *ContextError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected *ContextError cause, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected errors.Is(err, context.Canceled), got %v", err)
+	}
+	if o.Items[0].N != 1 || o.Items[1].N != 2 {
+		t.Errorf("no directive should run after cancellation, got %+v", o.Items)
+	}
+}
+
+// Cancellation is structural under ProcessStructAllContext: it is returned on
+// its own, not joined with field errors.
+func TestProcessStructAllContext_CancelledIsStructural(t *testing.T) {
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &RangeDirective{})
+
+	type form struct {
+		A int `val:"range, min=0, max=1"`
+		B int `val:"range, min=0, max=1"`
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ProcessStructAllContext(ctx, &form{A: 5, B: 5}, tag)
+	if n := countLeafErrors(err); n != 1 {
+		t.Fatalf("want 1 error, got %d: %v", n, err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+// cancelDirective cancels its context on the first call and counts the calls.
+type cancelDirective struct {
+	cancel context.CancelFunc
+	calls  *int
+}
+
+func (d *cancelDirective) Name() string        { return "slow" }
+func (d *cancelDirective) Mode() DirectiveMode { return EvalMode }
+func (d *cancelDirective) HandleContext(_ context.Context, val string) (string, error) {
+	*d.calls++
+	d.cancel()
+	return val, nil
+}
+
+// A group checks ctx before each element, so cancelling during the first
+// stops the walk instead of running the chain over every element.
+func TestProcessStructContext_CancelledStopsGroup(t *testing.T) {
+	type form struct {
+		S []string          `val:"each(slow)"`
+		M map[string]string `val:"values(slow)"`
+	}
+	tests := []struct {
+		name string
+		f    form
+		path string
+	}{
+		{"slice", form{S: make([]string, 1000)}, "S[1]"},
+		{"map", form{M: map[string]string{"a": "", "b": "", "c": ""}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var calls int
+			tag := NewTag(valTagKey)
+			MustRegisterContextDirective(tag, &cancelDirective{cancel: cancel, calls: &calls})
+
+			err := tag.ProcessStructContext(ctx, &tt.f)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+			var pe *ProcessError
+			if tt.path != "" && (!errors.As(err, &pe) || pe.FieldPath != tt.path) {
+				t.Errorf("want the error at %s, got %v", tt.path, err)
+			}
+			if calls != 1 {
+				t.Errorf("directive ran %d times, want 1", calls)
+			}
+		})
+	}
+}
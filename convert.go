@@ -0,0 +1,92 @@
+package tagex
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// UnderlyingConverter is an optional interface for directives that opt into
+// named-type conversion on their own, regardless of the Tag's setting (see
+// Tag.SetConvertUnderlying). A Directive[string] whose ConvertUnderlying
+// returns true also handles fields of type Email, given type Email string.
+type UnderlyingConverter interface {
+	ConvertUnderlying() bool
+}
+
+// convertedDirective runs a directive for T on a field of a named type with
+// T's underlying type: the field is converted to T for the directive, and in
+// MutMode the result is converted back.
+type convertedDirective struct {
+	anyDirective
+	to reflect.Type // the directive's T
+}
+
+func (c convertedDirective) clone() anyDirective {
+	return convertedDirective{anyDirective: c.anyDirective.clone(), to: c.to}
+}
+
+func (c convertedDirective) HandleAny(val reflect.Value) error {
+	return c.handle(context.Background(), val, &FieldInfo{})
+}
+
+func (c convertedDirective) handle(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	if !val.CanInterface() {
+		return &FieldAccessError{Msg: "cannot access field value"}
+	}
+	tmp := reflect.New(c.to).Elem()
+	tmp.Set(val.Convert(c.to))
+	if err := c.anyDirective.handle(ctx, tmp, field); err != nil {
+		return err
+	}
+	if m, ok := c.Unwrap().(interface{ Mode() DirectiveMode }); ok && m.Mode() == MutMode {
+		return valueSet(val, tmp.Convert(val.Type()))
+	}
+	return nil
+}
+
+// fitDirective checks the directive d against typ, the static type of the
+// value its segment will run on. A directive whose T can't be assigned to typ
+// is wrapped to dereference a pointer typ, to unwrap a wrapper type (see
+// Nullable), or to convert the value when
+// named-type conversion is on for it and typ has T's underlying type;
+// otherwise the mismatch is returned, with the reason no conversion applied. A
+// nil typ, or a d for any type, is left for run time.
+func fitDirective(tag *Tag, d anyDirective, typ reflect.Type) (anyDirective, *TypeMismatchError) {
+	to := d.valueType()
+	if typ == nil || to == nil || to.AssignableTo(typ) || implements(typ, to) || viaPointer(to, typ) {
+		return d, nil
+	}
+	if typ.Kind() == reflect.Ptr {
+		inner, err := fitDirective(tag, d, typ.Elem())
+		if err != nil {
+			return nil, &TypeMismatchError{Expected: typ, Got: to, Reason: err.Reason}
+		}
+		return derefDirective{anyDirective: inner, elem: typ.Elem()}, nil
+	}
+	if u, wrapped, ok := tag.unwrapperFor(typ); ok {
+		if inner, err := fitDirective(tag, d, wrapped); err == nil {
+			return unwrapDirective{anyDirective: inner, unwrap: u}, nil
+		}
+	}
+	on := tag.convertUnderlying
+	if uc, ok := d.Unwrap().(UnderlyingConverter); ok && uc.ConvertUnderlying() {
+		on = true
+	}
+	reason := ""
+	switch {
+	case typ.Kind() != to.Kind():
+		if on {
+			reason = fmt.Sprintf("%v has kind %v, not %v", typ, typ.Kind(), to.Kind())
+		}
+	case !typ.ConvertibleTo(to) || !to.ConvertibleTo(typ):
+		if on {
+			reason = fmt.Sprintf("%v and %v do not share an underlying type", typ, to)
+		}
+	case !on:
+		reason = fmt.Sprintf("%v has the underlying type of %v, but named-type conversion is off", typ, to)
+	default:
+		return convertedDirective{anyDirective: d, to: to}, nil
+	}
+	return nil, &TypeMismatchError{Expected: typ, Got: to, Reason: reason}
+}
@@ -0,0 +1,92 @@
+package tagex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type (
+	email  string
+	cents  int
+	userID int64
+)
+
+type account struct {
+	Email   email  `val:"trim;lower"`
+	Balance cents  `val:"mul, factor=2;range, min=0, max=100"`
+	Owner   userID `val:"range, min=1, max=9"`
+}
+
+func convertTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := eachTag(t)
+	MustRegisterDirective(tag, &MultiplyDirective{})
+	MustRegisterDirective(tag, &RangeDirective{})
+	return tag
+}
+
+func TestConvertUnderlying_Tag(t *testing.T) {
+	tag := convertTag(t)
+	tag.SetConvertUnderlying(true)
+
+	a := account{Email: " Ann@Example.COM ", Balance: 21}
+	err := ProcessStructAll(&a, tag)
+	if a.Email != "ann@example.com" || a.Balance != 42 {
+		t.Errorf("MutMode results not converted back: Email = %q, Balance = %d", a.Email, a.Balance)
+	}
+
+	// userID is int64, not int: the kinds differ, so RangeDirective doesn't
+	// apply and the error says why.
+	var tm *TypeMismatchError
+	if !errors.As(err, &tm) {
+		t.Fatalf("expected *TypeMismatchError for Owner, got %v", err)
+	}
+	if !strings.Contains(tm.Reason, "kind int64, not int") {
+		t.Errorf("Reason = %q", tm.Reason)
+	}
+}
+
+func TestConvertUnderlying_OffExplainsWhy(t *testing.T) {
+	tag := convertTag(t)
+
+	type profile struct {
+		Email email `val:"lower"`
+	}
+	err := tag.ProcessStruct(&profile{Email: "A"})
+	var tm *TypeMismatchError
+	if !errors.As(err, &tm) {
+		t.Fatalf("expected *TypeMismatchError, got %v", err)
+	}
+	if !strings.Contains(tm.Reason, "conversion is off") {
+		t.Errorf("Reason = %q, should say conversion is off", tm.Reason)
+	}
+
+	// Turning it on discards the cached plan.
+	tag.SetConvertUnderlying(true)
+	p := profile{Email: "A"}
+	if err := tag.ProcessStruct(&p); err != nil || p.Email != "a" {
+		t.Errorf("after SetConvertUnderlying: Email = %q, err = %v", p.Email, err)
+	}
+}
+
+// convertingLower opts into conversion on its own.
+type convertingLower struct{ lowerDirective }
+
+func (d *convertingLower) ConvertUnderlying() bool { return true }
+
+func TestConvertUnderlying_Directive(t *testing.T) {
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &convertingLower{})
+
+	type profile struct {
+		Emails []email `val:"each(lower)"`
+	}
+	p := profile{Emails: []email{"A@B"}}
+	if err := tag.ProcessStruct(&p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Emails[0] != "a@b" {
+		t.Errorf("Emails[0] = %q, want %q", p.Emails[0], "a@b")
+	}
+}
@@ -0,0 +1,38 @@
+package tagex
+
+import "reflect"
+
+// converter stores raw, the value of the param named param, in v.
+type converter func(v reflect.Value, raw, param string) error
+
+// RegisterConverter teaches every directive on t to convert a param of type T
+// with fn, so that a type such as Money or net.IPNet is handled once per Tag
+// rather than by a ParamConverter on each directive. fn is consulted before
+// DefaultConvert for a param of type T, and for T as a list element, map key
+// or value, or pointer target; an error from fn is a *ConversionError with the
+// error as its Err. A directive's own ParamConverter still takes precedence.
+// Registering T again replaces its converter.
+//
+//	tagex.RegisterConverter(tag, func(raw string) (Money, error) { return ParseMoney(raw) })
+func RegisterConverter[T any](t *Tag, fn func(raw string) (T, error)) {
+	typ := reflect.TypeFor[T]()
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.converters == nil {
+		t.converters = make(map[reflect.Type]converter)
+	}
+	t.converters[typ] = func(v reflect.Value, raw, param string) error {
+		val, err := fn(raw)
+		if err != nil {
+			return &ConversionError{Param: param, Raw: raw, Target: typ.String(), Err: err}
+		}
+		v.Set(reflect.ValueOf(&val).Elem())
+		return nil
+	}
+	t.resetPlans()
+}
+
+// paramConfig returns how t applies params. The caller holds t.mut.
+func (t *Tag) paramConfig() paramConfig {
+	return paramConfig{strict: t.strictParams, converters: t.converters, variables: true, vars: t.variables}
+}
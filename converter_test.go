@@ -0,0 +1,106 @@
+package tagex
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+// money is a param type DefaultConvert can't parse: "12.50 EUR".
+type money struct {
+	Amount   int
+	Currency string
+}
+
+func parseMoney(raw string) (money, error) {
+	var whole, frac int
+	var cur string
+	if _, err := fmt.Sscanf(raw, "%d.%d %s", &whole, &frac, &cur); err != nil {
+		return money{}, err
+	}
+	return money{Amount: whole*100 + frac, Currency: cur}, nil
+}
+
+// budgetDirective accepts a total in cents up to its limit.
+type budgetDirective struct {
+	Limit money   `param:"limit"`
+	Alts  []money `param:"alts, required=false"`
+}
+
+func (d *budgetDirective) Name() string        { return "budget" }
+func (d *budgetDirective) Mode() DirectiveMode { return EvalMode }
+func (d *budgetDirective) Handle(val int) (int, error) {
+	if val > d.Limit.Amount {
+		return val, errors.New("over budget")
+	}
+	return val, nil
+}
+
+func converterTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &budgetDirective{})
+	RegisterConverter(tag, parseMoney)
+	return tag
+}
+
+func TestRegisterConverter(t *testing.T) {
+	type order struct {
+		Total int `val:"budget, limit=12.50 EUR, alts='1.00 USD, 2.00 GBP'"`
+	}
+	if err := converterTag(t).ProcessStruct(&order{Total: 1250}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var he *HandleError
+	if err := converterTag(t).ProcessStruct(&order{Total: 1251}); !errors.As(err, &he) {
+		t.Fatalf("want a *HandleError, got %v", err)
+	}
+
+	// Without the converter the type is unsupported.
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &budgetDirective{})
+	var ue *UnsupportedParamTypeError
+	if err := tag.ProcessStruct(&order{}); !errors.As(err, &ue) {
+		t.Fatalf("want an *UnsupportedParamTypeError, got %v", err)
+	}
+}
+
+func TestRegisterConverter_Error(t *testing.T) {
+	type order struct {
+		Total int `val:"budget, limit=lots"`
+	}
+	err := converterTag(t).ProcessStruct(&order{})
+	var pe *ProcessError
+	if !errors.As(err, &pe) || pe.Stage != StageParam || pe.Param != "limit" {
+		t.Fatalf("want a StageParam failure of param limit, got %v", err)
+	}
+	var ce *ConversionError
+	if !errors.As(err, &ce) || ce.Raw != "lots" || ce.Target != "tagex.money" || ce.Err == nil {
+		t.Fatalf("want a *ConversionError wrapping the converter's error, got %v", err)
+	}
+}
+
+// A converter overrides DefaultConvert for its type, and registering it resets
+// compiled plans.
+func TestRegisterConverter_Override(t *testing.T) {
+	tag := chainTag(t)
+	type form struct {
+		S string `val:"length, min=one, max=5"`
+	}
+	if err := tag.ProcessStruct(&form{S: "a"}); err == nil {
+		t.Fatal("want min=one to fail before the converter is registered")
+	}
+	words := []string{"zero", "one", "two"}
+	RegisterConverter(tag, func(raw string) (int, error) {
+		for i, w := range words {
+			if raw == w {
+				return i, nil
+			}
+		}
+		return strconv.Atoi(raw)
+	})
+	if err := tag.ProcessStruct(&form{S: "a"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package tagex
+
+import (
+	"reflect"
+	"strings"
+)
+
+// FieldRef is a directive param type that names another field of the struct
+// being processed, so a directive can compare its field with a sibling
+// ("PasswordConfirm equals Password", "End after Start"):
+//
+//	type EqField struct {
+//		Other tagex.FieldRef `param:"field"`
+//	}
+//	// val:"eqfield, field=Password"
+//
+// Path is relative to the struct holding the tagged field; nested fields are
+// reached with dots ("Address.Country"). The reference is resolved against the
+// struct's type when its plan is compiled, so a path that names no exported
+// field fails there with a *FieldRefError instead of at Handle time. A
+// directive reads the referenced value from the FieldInfo it is handed (see
+// FieldDirective):
+//
+//	other := d.Other.Value(field)
+type FieldRef struct {
+	Path  string
+	index []int // resolved against the parent struct type; nil until then
+}
+
+var fieldRefType = reflect.TypeFor[FieldRef]()
+
+// Value returns the referenced field's value within field.Parent. It returns
+// the zero reflect.Value when the reference cannot be reached, e.g. through a
+// nil pointer.
+func (r FieldRef) Value(field FieldInfo) reflect.Value {
+	if field.reads != nil && !contains(*field.reads, r.Path) {
+		*field.reads = append(*field.reads, r.Path)
+	}
+	parent := field.Parent
+	for parent.Kind() == reflect.Ptr {
+		if parent.IsNil() {
+			return reflect.Value{}
+		}
+		parent = parent.Elem()
+	}
+	if !parent.IsValid() || parent.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	index := r.index
+	if index == nil {
+		var err error
+		if index, err = resolveFieldPath(parent.Type(), r.Path); err != nil {
+			return reflect.Value{}
+		}
+	}
+	v, err := parent.FieldByIndexErr(index)
+	if err != nil {
+		return reflect.Value{}
+	}
+	return v
+}
+
+// resolveFieldPath maps a dotted field path to its reflect index sequence in
+// the struct type typ, stepping through pointers to structs.
+func resolveFieldPath(typ reflect.Type, path string) ([]int, error) {
+	index, _, err := resolveField(typ, path)
+	return index, err
+}
+
+// resolveField is resolveFieldPath that also returns the named field's type.
+func resolveField(typ reflect.Type, path string) ([]int, reflect.Type, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, nil, &FieldRefError{Path: path, Reason: "empty path"}
+	}
+	var index []int
+	for _, name := range strings.Split(path, ".") {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return nil, nil, &FieldRefError{Path: path, Reason: name + " is not inside a struct"}
+		}
+		f, ok := typ.FieldByName(name)
+		if !ok || !f.IsExported() {
+			return nil, nil, &FieldRefError{Path: path, Reason: "no exported field " + name + " in " + typ.String()}
+		}
+		index = append(index, f.Index...)
+		typ = f.Type
+	}
+	return index, typ, nil
+}
+
+// resolveFieldRefs resolves every FieldRef param on the directive d (a pointer
+// to its struct, after ProcessParams) against parent, the struct type holding
+// the tagged field. It returns the referenced paths, or the failing param's
+// name and a *FieldRefError. A nil parent leaves references to be resolved by
+// name when Value is called.
+func resolveFieldRefs(d any, parent reflect.Type) (refs []string, param string, err error) {
+	val := reflect.ValueOf(d)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return nil, "", nil
+	}
+	val = val.Elem()
+	for n := 0; n < val.NumField(); n++ {
+		field := val.Type().Field(n)
+		if field.Type != fieldRefType {
+			continue
+		}
+		tagValue, ok := field.Tag.Lookup(paramKey)
+		if !ok {
+			continue
+		}
+		ref := val.Field(n).Addr().Interface().(*FieldRef)
+		if ref.Path == "" { // optional param left unset
+			continue
+		}
+		if parent != nil {
+			index, err := resolveFieldPath(parent, ref.Path)
+			if err != nil {
+				name, _, _ := strings.Cut(tagValue, ",")
+				return nil, strings.TrimSpace(name), err
+			}
+			ref.index = index
+		}
+		refs = append(refs, ref.Path)
+	}
+	return refs, "", nil
+}
@@ -0,0 +1,210 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// eqFieldDirective requires its field to equal the referenced one.
+type eqFieldDirective struct {
+	Other FieldRef `param:"field"`
+}
+
+func (d *eqFieldDirective) Name() string                      { return "eqfield" }
+func (d *eqFieldDirective) Mode() DirectiveMode               { return EvalMode }
+func (d *eqFieldDirective) Handle(val string) (string, error) { return val, nil }
+func (d *eqFieldDirective) HandleField(_ context.Context, val string, field FieldInfo) (string, error) {
+	if other := d.Other.Value(field); !other.IsValid() || other.String() != val {
+		return val, fmt.Errorf("must equal %s", d.Other.Path)
+	}
+	return val, nil
+}
+
+// gtFieldDirective requires its field to be greater than the referenced one.
+type gtFieldDirective struct {
+	Other FieldRef `param:"field"`
+}
+
+func (d *gtFieldDirective) Name() string                { return "gtfield" }
+func (d *gtFieldDirective) Mode() DirectiveMode         { return EvalMode }
+func (d *gtFieldDirective) Handle(val int) (int, error) { return val, nil }
+func (d *gtFieldDirective) HandleField(_ context.Context, val int, field FieldInfo) (int, error) {
+	if other := d.Other.Value(field); !other.IsValid() || int64(val) <= other.Int() {
+		return val, fmt.Errorf("must be after %s", d.Other.Path)
+	}
+	return val, nil
+}
+
+// betweenDirective requires its field to lie between two referenced ones,
+// reading Hi only once Lo has passed.
+type betweenDirective struct {
+	Lo FieldRef `param:"lo"`
+	Hi FieldRef `param:"hi"`
+}
+
+func (d *betweenDirective) Name() string                { return "between" }
+func (d *betweenDirective) Mode() DirectiveMode         { return EvalMode }
+func (d *betweenDirective) Handle(val int) (int, error) { return val, nil }
+func (d *betweenDirective) HandleField(_ context.Context, val int, field FieldInfo) (int, error) {
+	if int64(val) < d.Lo.Value(field).Int() {
+		return val, errors.New("too low")
+	}
+	if int64(val) > d.Hi.Value(field).Int() {
+		return val, errors.New("too high")
+	}
+	return val, nil
+}
+
+func crossFieldTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &eqFieldDirective{})
+	MustRegisterDirective(tag, &gtFieldDirective{})
+	MustRegisterDirective(tag, &betweenDirective{})
+	return tag
+}
+
+func TestCrossField_ComparesSiblings(t *testing.T) {
+	tag := crossFieldTag(t)
+
+	type signup struct {
+		Password        string
+		PasswordConfirm string `val:"eqfield, field=Password"`
+		Start           int
+		End             int `val:"gtfield, field=Start"`
+	}
+	if err := tag.ProcessStruct(&signup{Password: "pw", PasswordConfirm: "pw", Start: 1, End: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := ProcessStructAll(&signup{Password: "pw", PasswordConfirm: "px", Start: 3, End: 2}, tag)
+	if n := countLeafErrors(err); n != 2 {
+		t.Fatalf("want 2 errors, got %d: %v", n, err)
+	}
+	var cf *CrossFieldError
+	if !errors.As(err, &cf) {
+		t.Fatalf("expected *CrossFieldError, got %v", err)
+	}
+	if cf.FieldPath != "PasswordConfirm" || cf.OtherPath != "Password" {
+		t.Errorf("got (%q, %q), want (PasswordConfirm, Password)", cf.FieldPath, cf.OtherPath)
+	}
+	var he *HandleError
+	if !errors.As(err, &he) {
+		t.Errorf("expected the directive's *HandleError to stay reachable, got %v", err)
+	}
+}
+
+// A CrossFieldError names the refs the directive read, and only wraps the
+// directive's own failure.
+func TestCrossField_NamesRefsRead(t *testing.T) {
+	tag := crossFieldTag(t)
+
+	type window struct {
+		Min, Max int
+		N        int `val:"between, lo=Min, hi=Max"`
+	}
+	tests := []struct {
+		n     int
+		other string
+		all   []string
+	}{
+		{0, "Min", []string{"Min"}},
+		{9, "Max", []string{"Min", "Max"}},
+	}
+	for _, tt := range tests {
+		err := tag.ProcessStruct(&window{Min: 1, Max: 5, N: tt.n})
+		var cf *CrossFieldError
+		if !errors.As(err, &cf) {
+			t.Fatalf("N=%d: expected *CrossFieldError, got %v", tt.n, err)
+		}
+		if cf.OtherPath != tt.other || !reflect.DeepEqual(cf.OtherPaths, tt.all) {
+			t.Errorf("N=%d: got (%q, %q), want (%q, %q)", tt.n, cf.OtherPath, cf.OtherPaths, tt.other, tt.all)
+		}
+	}
+
+	// A value the directive can't take is a type mismatch, not a comparison.
+	type loose struct {
+		Password string
+		Confirm  any `val:"eqfield, field=Password"`
+	}
+	err := tag.ProcessStruct(&loose{Password: "pw", Confirm: 7})
+	var cf *CrossFieldError
+	var tm *TypeMismatchError
+	if errors.As(err, &cf) || !errors.As(err, &tm) {
+		t.Errorf("want a bare *TypeMismatchError, got %v", err)
+	}
+}
+
+// References resolve against the struct holding the field, so nested structs
+// and collection elements name their paths from the root.
+func TestCrossField_NestedPaths(t *testing.T) {
+	tag := crossFieldTag(t)
+
+	type address struct {
+		Country string
+	}
+	type shipment struct {
+		Address address
+		Origin  string `val:"eqfield, field=Address.Country"`
+	}
+	type order struct {
+		Shipments []shipment
+	}
+	o := order{Shipments: []shipment{
+		{Address: address{Country: "NL"}, Origin: "NL"},
+		{Address: address{Country: "NL"}, Origin: "BE"},
+	}}
+	err := tag.ProcessStruct(&o)
+	var cf *CrossFieldError
+	if !errors.As(err, &cf) {
+		t.Fatalf("expected *CrossFieldError, got %v", err)
+	}
+	if cf.FieldPath != "Shipments[1].Origin" || cf.OtherPath != "Shipments[1].Address.Country" {
+		t.Errorf("got (%q, %q)", cf.FieldPath, cf.OtherPath)
+	}
+}
+
+func TestCrossField_UnresolvableIsParamError(t *testing.T) {
+	tag := crossFieldTag(t)
+
+	type form struct {
+		Confirm string `val:"eqfield, field=Pasword"`
+	}
+	err := tag.ProcessStruct(&form{})
+	var pe *ProcessError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *ProcessError, got %v", err)
+	}
+	if pe.Stage != StageParam || pe.Param != "field" || pe.Directive != "eqfield" {
+		t.Errorf("got stage %q param %q directive %q", pe.Stage, pe.Param, pe.Directive)
+	}
+	var re *FieldRefError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected *FieldRefError, got %v", err)
+	}
+	if re.Path != "Pasword" {
+		t.Errorf("Path = %q, want %q", re.Path, "Pasword")
+	}
+}
+
+func TestResolveFieldPath(t *testing.T) {
+	type inner struct{ C int }
+	type outer struct {
+		A      int
+		Ptr    *inner
+		hidden int
+	}
+	typ := reflect.TypeFor[outer]()
+	if _, err := resolveFieldPath(typ, "Ptr.C"); err != nil {
+		t.Errorf("Ptr.C: unexpected error: %v", err)
+	}
+	for _, path := range []string{"", "B", "hidden", "A.B", "Ptr.D"} {
+		var re *FieldRefError
+		if _, err := resolveFieldPath(typ, path); !errors.As(err, &re) {
+			t.Errorf("%q: expected *FieldRefError, got %v", path, err)
+		}
+	}
+}
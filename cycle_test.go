@@ -0,0 +1,135 @@
+package tagex
+
+import (
+	"errors"
+	"testing"
+)
+
+type cycleNode struct {
+	N    int `val:"range, min=0, max=10"`
+	Next *cycleNode
+}
+
+func cycleTag(t *testing.T, mode CycleMode) *Tag {
+	t.Helper()
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &RangeDirective{})
+	tag.SetCycleMode(mode)
+	return tag
+}
+
+func TestCycleMode_ReportNamesBothPaths(t *testing.T) {
+	tag := cycleTag(t, CycleReport)
+
+	a := &cycleNode{N: 1}
+	b := &cycleNode{N: 2, Next: a}
+	a.Next = b
+
+	err := tag.ProcessStruct(a)
+	var pe *ProcessError
+	if !errors.As(err, &pe) || pe.Stage != StageStruct {
+		t.Fatalf("expected StageStruct *ProcessError, got %v", err)
+	}
+	var ce *CycleError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected *CycleError, got %v", err)
+	}
+	if ce.Path != "Next.Next" || ce.FirstPath != "" {
+		t.Errorf("got (%q, %q), want (%q, %q)", ce.Path, ce.FirstPath, "Next.Next", "")
+	}
+	if pe.FieldPath != ce.Path {
+		t.Errorf("FieldPath = %q, want %q", pe.FieldPath, ce.Path)
+	}
+}
+
+func TestCycleMode_ReportInnerCycle(t *testing.T) {
+	tag := cycleTag(t, CycleReport)
+
+	type holder struct {
+		Head *cycleNode
+	}
+	n := &cycleNode{N: 1}
+	n.Next = n
+
+	var ce *CycleError
+	if err := tag.ProcessStruct(&holder{Head: n}); !errors.As(err, &ce) {
+		t.Fatalf("expected *CycleError, got %v", err)
+	}
+	if ce.Path != "Head.Next" || ce.FirstPath != "Head" {
+		t.Errorf("got (%q, %q), want (%q, %q)", ce.Path, ce.FirstPath, "Head.Next", "Head")
+	}
+}
+
+func TestCycleMode_SkipProcessesEachNodeOnce(t *testing.T) {
+	tag := NewTag("mul")
+	MustRegisterDirective(tag, &MultiplyDirective{})
+	tag.SetCycleMode(CycleSkip)
+
+	type node struct {
+		N    int `mul:"mul, factor=2"`
+		Next *node
+	}
+	a := &node{N: 1}
+	b := &node{N: 3, Next: a}
+	a.Next = b
+
+	if err := tag.ProcessStruct(a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.N != 2 || b.N != 6 {
+		t.Errorf("expected each node doubled once, got a=%d b=%d", a.N, b.N)
+	}
+}
+
+// A node shared by siblings is not a cycle: only the current path counts.
+func TestCycleMode_SharedNodeIsNotACycle(t *testing.T) {
+	tag := cycleTag(t, CycleReport)
+
+	type pair struct {
+		Left, Right *cycleNode
+	}
+	shared := &cycleNode{N: 1}
+	if err := tag.ProcessStruct(&pair{Left: shared, Right: shared}); err != nil {
+		t.Fatalf("shared node reported as a cycle: %v", err)
+	}
+}
+
+func TestSetMaxDepth(t *testing.T) {
+	build := func(n int) *cycleNode {
+		head := &cycleNode{N: 1}
+		cur := head
+		for i := 0; i < n; i++ {
+			cur.Next = &cycleNode{N: 1}
+			cur = cur.Next
+		}
+		return head
+	}
+
+	// A legitimately deep acyclic chain beyond the default limit.
+	tag := cycleTag(t, CycleOff)
+	var depthErr *MaxDepthError
+	if err := tag.ProcessStruct(build(2000)); !errors.As(err, &depthErr) {
+		t.Fatalf("expected *MaxDepthError at the default limit, got %v", err)
+	}
+	tag.SetMaxDepth(10000)
+	if err := tag.ProcessStruct(build(2000)); err != nil {
+		t.Fatalf("expected the raised limit to pass, got %v", err)
+	}
+
+	// A lowered limit is reported with its own value.
+	tag.SetMaxDepth(10)
+	err := tag.ProcessStruct(build(20))
+	if !errors.As(err, &depthErr) || depthErr.Limit != 10 {
+		t.Fatalf("expected *MaxDepthError with Limit 10, got %v", err)
+	}
+
+	// Tags processed together share the smallest limit, in either order.
+	deep := cycleTag(t, CycleOff)
+	deep.SetMaxDepth(10000)
+	for _, tags := range [][]*Tag{{tag, deep}, {deep, tag}} {
+		err := ProcessStruct(build(20), tags...)
+		if !errors.As(err, &depthErr) || depthErr.Limit != 10 {
+			t.Fatalf("expected *MaxDepthError with Limit 10, got %v", err)
+		}
+	}
+}
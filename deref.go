@@ -0,0 +1,80 @@
+package tagex
+
+import (
+	"context"
+	"reflect"
+)
+
+// NilHandler is an optional interface for directives that need to observe a
+// nil pointer field. A Directive[T] applied to a *T field runs on the pointed-to
+// value and is skipped when the pointer is nil; a directive implementing
+// NilHandler has HandleNil called instead, so a "required" rule can reject the
+// missing value. A non-nil error fails the segment like an error from Handle.
+type NilHandler interface {
+	HandleNil(ctx context.Context, field FieldInfo) error
+}
+
+// NilAllocator is an optional interface for MutMode directives that fill in a
+// nil pointer field: when AllocateNil returns true, a new zero T is allocated,
+// handed to the directive, and stored in the field if the directive succeeds.
+// It is ignored on an EvalMode directive, which leaves the field nil. If the
+// directive also implements NilHandler, HandleNil runs first.
+type NilAllocator interface {
+	AllocateNil() bool
+}
+
+// derefDirective runs a directive for T on a *T value: on the pointed-to value
+// when the pointer is set, and according to NilHandler and NilAllocator when it
+// is nil. elem is the pointer's element type.
+type derefDirective struct {
+	anyDirective
+	elem reflect.Type
+}
+
+func (d derefDirective) clone() anyDirective {
+	return derefDirective{anyDirective: d.anyDirective.clone(), elem: d.elem}
+}
+
+func (d derefDirective) HandleAny(val reflect.Value) error {
+	return d.handle(context.Background(), val, &FieldInfo{})
+}
+
+func (d derefDirective) handle(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	if !val.IsNil() {
+		return d.anyDirective.handle(ctx, val.Elem(), field)
+	}
+	if err := handleNil(ctx, d.anyDirective, field); err != nil {
+		return err
+	}
+	na, ok := d.Unwrap().(NilAllocator)
+	if !ok || directiveMode(d.anyDirective) != MutMode || !na.AllocateNil() {
+		return nil
+	}
+	if !val.CanSet() {
+		return &FieldSetError{Msg: "unable to set field value"}
+	}
+	p := reflect.New(d.elem)
+	if err := d.anyDirective.handle(ctx, p.Elem(), field); err != nil {
+		return err
+	}
+	val.Set(p)
+	return nil
+}
+
+// directiveMode returns the Mode of the directive d wraps.
+func directiveMode(d anyDirective) DirectiveMode {
+	if m, ok := d.Unwrap().(interface{ Mode() DirectiveMode }); ok {
+		return m.Mode()
+	}
+	return EvalMode
+}
+
+// handleNil calls d's HandleNil, if it has one, for a value that is absent.
+func handleNil(ctx context.Context, d anyDirective, field *FieldInfo) error {
+	if nh, ok := d.Unwrap().(NilHandler); ok {
+		if err := nh.HandleNil(ctx, *field); err != nil {
+			return &HandleError{Nested: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// presentDirective is a "required" that also sees nil pointers.
+type presentDirective struct{}
+
+func (d *presentDirective) Name() string        { return "present" }
+func (d *presentDirective) Mode() DirectiveMode { return EvalMode }
+func (d *presentDirective) Handle(val string) (string, error) {
+	if val == "" {
+		return val, errors.New("is empty")
+	}
+	return val, nil
+}
+func (d *presentDirective) HandleNil(_ context.Context, field FieldInfo) error {
+	return errors.New(field.Field.Name + " is missing")
+}
+
+// fallbackDirective fills in an empty string, allocating a nil pointer first.
+type fallbackDirective struct {
+	Value string `param:"value"`
+}
+
+func (d *fallbackDirective) Name() string        { return "fallback" }
+func (d *fallbackDirective) Mode() DirectiveMode { return MutMode }
+func (d *fallbackDirective) AllocateNil() bool   { return true }
+func (d *fallbackDirective) Handle(val string) (string, error) {
+	if val == "" {
+		return d.Value, nil
+	}
+	return val, nil
+}
+
+// defaultedDirective asks for allocation but only checks, so it gets none.
+type defaultedDirective struct{}
+
+func (d *defaultedDirective) Name() string                      { return "defaulted" }
+func (d *defaultedDirective) Mode() DirectiveMode               { return EvalMode }
+func (d *defaultedDirective) AllocateNil() bool                 { return true }
+func (d *defaultedDirective) Handle(val string) (string, error) { return val, nil }
+
+func derefTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := chainTag(t)
+	MustRegisterDirective(tag, &RangeDirective{})
+	MustRegisterDirective(tag, &presentDirective{})
+	MustRegisterDirective(tag, &fallbackDirective{})
+	MustRegisterDirective(tag, &defaultedDirective{})
+	return tag
+}
+
+type patch struct {
+	Name  *string  `val:"trim;length, min=2, max=10"`
+	Age   *int     `val:"range, min=0, max=150"`
+	Nick  **string `val:"trim"`
+	Email *string  `val:"present"`
+	Lang  *string  `val:"fallback, value=en"`
+}
+
+func TestDeref_WritesThroughAndSkipsNil(t *testing.T) {
+	tag := derefTag(t)
+
+	name, age, nick, email := "  ann  ", 30, " a ", "a@b"
+	pn := &nick
+	p := patch{Name: &name, Age: &age, Nick: &pn, Email: &email}
+	if err := tag.ProcessStruct(&p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name != "ann" || nick != "a" {
+		t.Errorf("MutMode should write through the pointers: Name = %q, Nick = %q", name, nick)
+	}
+
+	age = 200
+	var pe *ProcessError
+	if err := tag.ProcessStruct(&p); !errors.As(err, &pe) || pe.FieldPath != "Age" {
+		t.Errorf("want failure at Age, got %v", err)
+	}
+
+	// Nil pointers are skipped, except by a NilHandler.
+	err := ProcessStructAll(&patch{}, tag)
+	if n := countLeafErrors(err); n != 1 {
+		t.Fatalf("want 1 error, got %d: %v", n, err)
+	}
+	var he *HandleError
+	if !errors.As(err, &he) || he.Error() != "Email is missing" {
+		t.Errorf("want the NilHandler's error, got %v", err)
+	}
+}
+
+func TestDeref_AllocatesWhenAsked(t *testing.T) {
+	tag := derefTag(t)
+
+	email := "a@b"
+	p := patch{Email: &email}
+	if err := tag.ProcessStruct(&p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Lang == nil || *p.Lang != "en" {
+		t.Errorf("Lang = %v, want a pointer to %q", p.Lang, "en")
+	}
+	if p.Name != nil || p.Age != nil {
+		t.Errorf("other nil fields should stay nil")
+	}
+
+	// An EvalMode directive can't store a value, so it allocates nothing.
+	var q struct {
+		S *string `val:"defaulted"`
+	}
+	if err := tag.ProcessStruct(&q); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.S != nil {
+		t.Errorf("S = %v, want nil for an EvalMode NilAllocator", q.S)
+	}
+}
+
+func TestDeref_OverloadByElemType(t *testing.T) {
+	tag := sizeTag(t)
+
+	type opt struct {
+		S *string `val:"size, max=2"`
+		B *[]byte `val:"size, max=2"`
+	}
+	s, b := "abc", []byte("abc")
+	err := ProcessStructAll(&opt{S: &s, B: &b}, tag)
+	if n := countLeafErrors(err); n != 2 {
+		t.Fatalf("want 2 errors, got %d: %v", n, err)
+	}
+}
@@ -1,9 +1,10 @@
 package tagex
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 // ParamConverter allows a directive to control how its parameters
@@ -34,10 +35,78 @@ type Directive[T any] interface {
 	Handle(val T) (T, error)
 }
 
+// ContextDirective is the context-aware variant of Directive: HandleContext
+// receives the context passed to ProcessStructContext (context.Background for
+// ProcessStruct), so a directive that does I/O can honor deadlines and
+// cancellation. Register it with RegisterContextDirective.
+//
+// A Directive[T] that also has a HandleContext method with this signature is
+// called through HandleContext instead of Handle.
+type ContextDirective[T any] interface {
+	Name() string
+	Mode() DirectiveMode
+	HandleContext(ctx context.Context, val T) (T, error)
+}
+
+// FieldDirective is an optional interface for directives that need to know
+// which field they are applied to: HandleField receives a FieldInfo alongside
+// the value. A registered Directive[T] or ContextDirective[T] that implements it
+// is called through HandleField instead of Handle or HandleContext; ctx is the
+// same context HandleContext would receive.
+type FieldDirective[T any] interface {
+	HandleField(ctx context.Context, val T, field FieldInfo) (T, error)
+}
+
+// ValueDirective is a directive that works on the field's reflect.Value rather
+// than on a T, for rules that apply across types: required (non-zero), notnil,
+// len over strings, slices, and maps. Register it with RegisterValueDirective.
+//
+// HandleValue receives the value and the field it belongs to. In MutMode the
+// returned value is written back, provided it is assignable to the field's
+// type; in EvalMode it is ignored. HandleValue should not Set val itself.
+//
+// A ValueDirective may share its name with typed directives; it then handles
+// the field types none of them does (see RegisterDirective).
+type ValueDirective interface {
+	Name() string
+	Mode() DirectiveMode
+	HandleValue(ctx context.Context, val reflect.Value, field FieldInfo) (reflect.Value, error)
+}
+
+// FieldInfo describes the struct field a directive is being applied to.
+type FieldInfo struct {
+	// Field is the field's declaration. Field.Tag holds every tag on the
+	// field, not only the one being processed.
+	Field reflect.StructField
+	// Path is the field's path from the processed struct, in the same form
+	// as ProcessError.FieldPath (e.g. Items[2].SKU).
+	Path string
+	// TagKey is the key of the Tag whose directive is running.
+	TagKey string
+	// Parent is the struct value that holds the field.
+	Parent reflect.Value
+
+	parentPath string    // Parent's own path, for naming FieldRef targets
+	reads      *[]string // when set, FieldRef.Value records the paths it reads
+}
+
+// TagName returns the field's name under the naming tag key (such as "json"):
+// the tag value up to its first ','. It falls back to Field.Name when the tag
+// is absent, empty, or "-", so messages can name a field the way clients see it.
+func (f FieldInfo) TagName(key string) string {
+	name, _, _ := strings.Cut(f.Field.Tag.Get(key), ",")
+	if name == "" || name == "-" {
+		return f.Field.Name
+	}
+	return name
+}
+
 type anyDirective interface {
 	HandleAny(val reflect.Value) error
 	Unwrap() any
 	clone() anyDirective
+	valueType() reflect.Type
+	handle(ctx context.Context, val reflect.Value, field *FieldInfo) error
 }
 
 type directiveWrapper[T any] struct {
@@ -52,27 +121,120 @@ func (dw directiveWrapper[T]) Unwrap() any {
 // is only a template; per-call parameter state is written to the copy so that
 // concurrent ProcessStruct calls on a shared Tag never race on its fields.
 func (dw directiveWrapper[T]) clone() anyDirective {
-	src := reflect.ValueOf(dw.Directive)
+	return directiveWrapper[T]{Directive: cloneDirective(dw.Directive)}
+}
+
+func (dw directiveWrapper[T]) valueType() reflect.Type {
+	return reflect.TypeFor[T]()
+}
+
+func (dw directiveWrapper[T]) HandleAny(val reflect.Value) error {
+	return dw.handle(context.Background(), val, &FieldInfo{})
+}
+
+func (dw directiveWrapper[T]) handle(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	if fd, ok := dw.Directive.(FieldDirective[T]); ok {
+		return handleValue(val, dw.Mode(), func(t T) (T, error) {
+			return fd.HandleField(ctx, t, *field)
+		})
+	}
+	if cd, ok := dw.Directive.(ContextDirective[T]); ok {
+		return handleValue(val, dw.Mode(), func(t T) (T, error) {
+			return cd.HandleContext(ctx, t)
+		})
+	}
+	return handleValue(val, dw.Mode(), dw.Handle)
+}
+
+type contextDirectiveWrapper[T any] struct {
+	ContextDirective[T]
+}
+
+func (cw contextDirectiveWrapper[T]) Unwrap() any {
+	return cw.ContextDirective
+}
+
+func (cw contextDirectiveWrapper[T]) clone() anyDirective {
+	return contextDirectiveWrapper[T]{ContextDirective: cloneDirective(cw.ContextDirective)}
+}
+
+func (cw contextDirectiveWrapper[T]) valueType() reflect.Type {
+	return reflect.TypeFor[T]()
+}
+
+func (cw contextDirectiveWrapper[T]) HandleAny(val reflect.Value) error {
+	return cw.handle(context.Background(), val, &FieldInfo{})
+}
+
+func (cw contextDirectiveWrapper[T]) handle(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	if fd, ok := cw.ContextDirective.(FieldDirective[T]); ok {
+		return handleValue(val, cw.Mode(), func(t T) (T, error) {
+			return fd.HandleField(ctx, t, *field)
+		})
+	}
+	return handleValue(val, cw.Mode(), func(t T) (T, error) {
+		return cw.HandleContext(ctx, t)
+	})
+}
+
+type valueDirectiveWrapper struct {
+	ValueDirective
+}
+
+func (vw valueDirectiveWrapper) Unwrap() any {
+	return vw.ValueDirective
+}
+
+func (vw valueDirectiveWrapper) clone() anyDirective {
+	return valueDirectiveWrapper{ValueDirective: cloneDirective(vw.ValueDirective)}
+}
+
+// valueType is nil: a ValueDirective handles any type.
+func (vw valueDirectiveWrapper) valueType() reflect.Type {
+	return nil
+}
+
+func (vw valueDirectiveWrapper) HandleAny(val reflect.Value) error {
+	return vw.handle(context.Background(), val, &FieldInfo{})
+}
+
+func (vw valueDirectiveWrapper) handle(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	out, err := vw.HandleValue(ctx, val, *field)
+	if err != nil {
+		return &HandleError{Nested: err}
+	}
+	if vw.Mode() == MutMode {
+		return valueSet(val, out)
+	}
+	return nil
+}
+
+// cloneDirective copies the struct behind a pointer directive d. Value
+// directives carry no settable param state, so they are returned as is.
+func cloneDirective[D any](d D) D {
+	src := reflect.ValueOf(d)
 	if src.Kind() != reflect.Ptr || src.IsNil() {
-		return dw // value directives carry no settable param state to copy
+		return d
 	}
 	dup := reflect.New(src.Elem().Type())
 	dup.Elem().Set(src.Elem())
-	return directiveWrapper[T]{Directive: dup.Interface().(Directive[T])}
+	return dup.Interface().(D)
 }
 
-func (dw directiveWrapper[T]) HandleAny(val reflect.Value) (err error) {
+// handleValue reads val as a T, passes it to fn, and in MutMode writes the
+// result back. A non-nil error from fn is wrapped in a *HandleError.
+func handleValue[T any](val reflect.Value, mode DirectiveMode, fn func(T) (T, error)) error {
 	t, err := valParse[T](val)
 	if err != nil {
 		return err
 	}
 
-	t, err = dw.Handle(t)
+	t, err = fn(t)
 	if err != nil {
 		return &HandleError{Nested: err}
 	}
 
-	if dw.Mode() == MutMode {
+	if mode == MutMode {
 		return valSet(val, t)
 	}
 
@@ -83,6 +245,9 @@ func valSet[T any](val reflect.Value, t T) (err error) {
 	if !val.CanSet() {
 		return &FieldSetError{Msg: "unable to set field value"}
 	}
+	if reflect.TypeFor[T]().Kind() == reflect.Interface {
+		return interfaceSet(val, reflect.ValueOf(t))
+	}
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -94,6 +259,57 @@ func valSet[T any](val reflect.Value, t T) (err error) {
 	return nil
 }
 
+// valueSet is valSet for a result that is already a reflect.Value: it is
+// written to val only if it is valid and assignable to val's type.
+func valueSet(val, out reflect.Value) (err error) {
+	if !val.CanSet() {
+		return &FieldSetError{Msg: "unable to set field value"}
+	}
+	if !out.IsValid() {
+		return &FieldSetError{Msg: "cannot set field to an invalid reflect.Value"}
+	}
+	if !out.Type().AssignableTo(val.Type()) {
+		return &TypeMismatchError{Expected: val.Type(), Got: out.Type()}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &FieldSetError{Msg: fmt.Sprintf("failed to set field value: %v", r)}
+		}
+	}()
+	val.Set(out)
+
+	return nil
+}
+
+// interfaceSet writes back the result of a directive whose T is an interface.
+// out holds the result's dynamic value. It is stored if its type is assignable
+// to the field's; a pointer to the field's type (as handed to a directive
+// whose methods have pointer receivers) stores what it points to; and a nil
+// result zeroes a field that can be nil. Anything else is a mismatch.
+func interfaceSet(val, out reflect.Value) error {
+	switch {
+	case !out.IsValid():
+		switch val.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return valueSet(val, reflect.Zero(val.Type()))
+		}
+		return &FieldSetError{Msg: fmt.Sprintf("cannot set a field of type %v to nil", val.Type())}
+	case out.Type().AssignableTo(val.Type()):
+		return valueSet(val, out)
+	case out.Kind() == reflect.Ptr && out.Type().Elem() == val.Type():
+		if out.IsNil() {
+			return &FieldSetError{Msg: fmt.Sprintf("cannot set a field of type %v from a nil %v", val.Type(), out.Type())}
+		}
+		return valueSet(val, out.Elem())
+	}
+	return &TypeMismatchError{
+		Expected: val.Type(),
+		Got:      out.Type(),
+		Reason:   "a MutMode result must hold a value of the field's type",
+	}
+}
+
 func valParse[T any](val reflect.Value) (T, error) {
 	var zero T
 	if !val.CanInterface() {
@@ -103,6 +319,9 @@ func valParse[T any](val reflect.Value) (T, error) {
 	if err := valTypeAssert[T](val); err != nil {
 		return zero, err
 	}
+	if viaPointer(reflect.TypeFor[T](), val.Type()) {
+		val = val.Addr() // valTypeAssert checked it is addressable
+	}
 
 	t, ok := val.Interface().(T)
 	if !ok {
@@ -113,81 +332,31 @@ func valParse[T any](val reflect.Value) (T, error) {
 
 func valTypeAssert[T any](val reflect.Value) error {
 	t := reflect.TypeFor[T]()
-	if t.AssignableTo(val.Type()) {
+	if t.AssignableTo(val.Type()) || implements(val.Type(), t) {
 		return nil
 	}
-	return &TypeMismatchError{Expected: val.Type(), Got: t}
-}
-
-// processDirective applies every directive in tagValue to fieldValue. Directives
-// are chained with ';' and run left-to-right; each MutMode segment's written-back
-// value is what the next segment reads, so order is significant
-// ("trim;length, min=3" differs from "length, min=3;trim"). Processing stops at
-// the first failing segment and returns its error. Note that under
-// ProcessStructAll a MutMode segment that already ran has still mutated the field
-// even when a later segment in the same chain fails.
-func processDirective(tag *Tag, tagValue string, fieldValue reflect.Value) error {
-	for _, seg := range splitChain(tagValue) {
-		if err := processSegment(tag, seg, fieldValue); err != nil {
-			return err
+	if viaPointer(t, val.Type()) {
+		if val.CanAddr() {
+			return nil
+		}
+		return &TypeMismatchError{
+			Expected: val.Type(),
+			Got:      t,
+			Reason:   fmt.Sprintf("only *%v implements %v, and the value is not addressable", val.Type(), t),
 		}
 	}
-	return nil
+	return &TypeMismatchError{Expected: val.Type(), Got: t}
 }
 
-// processSegment applies a single directive segment ("name, k=v, ...") to
-// fieldValue: it parses the directive name and args, runs the directive on a
-// per-call copy, and (in MutMode) writes the result back to fieldValue.
-func processSegment(tag *Tag, tagValue string, fieldValue reflect.Value) error {
-	var err error
+// implements reports whether a value of type typ can be handed to a directive
+// whose T is the interface type to.
+func implements(typ, to reflect.Type) bool {
+	return to.Kind() == reflect.Interface && typ.Implements(to)
+}
 
-	directiveName, args, err := splitTagValue(tagValue)
-	if err != nil {
-		stage := StageDirective
-		var paramErr *ParamParseError
-		if errors.As(err, &paramErr) {
-			stage = StageParam
-		}
-		return &ProcessError{
-			Stage:     stage,
-			Directive: directiveName,
-			Cause:     err,
-		}
-	}
-	template, ok := tag.directive(directiveName)
-	if !ok {
-		return &ProcessError{
-			Stage:     StageDirective,
-			Directive: directiveName,
-			Cause:     &UnknownDirectiveError{Name: directiveName},
-		}
-	}
-	directive := template.clone() // per-call copy; never mutate the shared template
-	err = ProcessParams(directive.Unwrap(), args)
-	if err != nil {
-		param := ""
-		var missingErr *MissingParamError
-		if errors.As(err, &missingErr) {
-			param = missingErr.Param
-		}
-		var convErr *ConversionError
-		if errors.As(err, &convErr) && param == "" {
-			param = convErr.Param
-		}
-		return &ProcessError{
-			Stage:     StageParam,
-			Directive: directiveName,
-			Param:     param,
-			Cause:     err,
-		}
-	}
-	err = directive.HandleAny(fieldValue)
-	if err != nil {
-		return &ProcessError{
-			Stage:     StageDirective,
-			Directive: directiveName,
-			Cause:     err,
-		}
-	}
-	return nil
+// viaPointer reports whether a directive whose T is the interface type to can
+// only take a value of type typ through its address, because the methods of to
+// have pointer receivers on typ.
+func viaPointer(to, typ reflect.Type) bool {
+	return to.Kind() == reflect.Interface && !typ.Implements(to) && reflect.PointerTo(typ).Implements(to)
 }
@@ -12,14 +12,37 @@
 //  - Create a Tag with NewTag.
 //  - Implement a Directive[T] for the field type you want to handle.
 //  - Register the directive with MustRegisterDirective (or RegisterDirective,
-//    which returns an error instead of panicking).
+//    which returns an error instead of panicking). Directives for different
+//    field types may share a name; each field uses the one matching its type.
+//  - A directive for T also runs on *T fields; nil pointers are skipped unless
+//    the directive implements NilHandler or NilAllocator.
+//  - Directives see through optional wrappers: the database/sql Null types,
+//    types implementing Nullable, and types registered with RegisterUnwrapper.
+//  - Call Tag.SetConvertUnderlying to apply a directive for T to named types
+//    with T's underlying type (type Email string).
+//  - Implement a ValueDirective (RegisterValueDirective) for a rule that works on
+//    any field type through its reflect.Value, such as required or len.
 //  - Call ProcessStruct on a pointer to a struct to execute directives.
 //  - To apply multiple tags in one pass, call tagex.ProcessStruct(data, tag1, tag2, ...).
 //  - Use ProcessStructAll to collect every field failure (returned as errors.Join)
 //    instead of stopping at the first.
+//  - Use ProcessStructContext (or ProcessStructAllContext) to pass a context to
+//    ContextDirective implementations and stop processing when it is done.
 //  - Chain several directives on one field by separating them with ';'
 //    ("trim;range, min=2"): they run left to right, each MutMode result feeding
 //    the next, and processing stops at the first failing segment.
+//  - Start a chain with omitempty (or ?) to skip it on a zero value:
+//    "?length, min=3" checks the field only when it is set.
+//  - Name a reusable chain with Tag.RegisterMacro and write the name in tags;
+//    ${param} placeholders in it are filled from the tag's args.
+//  - Apply a chain to every element of a slice, array, or map with a group:
+//    each(trim;lower), or keys(...) and values(...) for a map's keys and values.
+//  - Run a chain only when a sibling field matches with when(...) or unless(...):
+//    when(Country in (DE, FR): required).
+//  - Combine chains with any(email; phone), all(trim;email), and not(...):
+//    any passes if one alternative does and reports every failure in an AnyError.
+//  - Use Parse to read a tag value as a Chain (for linters and code
+//    generators) and Chain.String to print one back in canonical form.
 //
 // Directive Mode:
 //
@@ -33,10 +56,22 @@
 //  - A parameter value may be single-quoted to hold ',', ';', '=', or
 //    surrounding whitespace literally (pattern='\d{1,3}'); double an interior
 //    quote ('') for a literal '.
-//  - The default converters support string, int, int64, float64, and bool.
+//  - The default converters support string, bool, every sized int, uint, and
+//    float, time.Duration, encoding.TextUnmarshaler types, slices (a ','-list:
+//    ids='1,2,3'), maps (limits='a=1,b=2'), and pointers to these.
 //  - Directives can override conversion by implementing ParamConverter.
 //  - DefaultConvert exposes the built-in conversion for reuse as a fallback.
+//  - RegisterConverter teaches every directive on a Tag a param type, ahead of
+//    the built-in conversion.
 //  - ProcessParams exposes this parameter application logic for reuse.
+//  - Tag.SetStrictParams rejects args that name no param (suggesting the
+//    closest) and keys given twice; ProcessParamsStrict is the Tag-free form.
+//  - A bare arg (no '=') fills a param tagged pos=N or variadic, or sets a
+//    bool param tagged flag: oneof, red, green, blue; trim, left.
+//  - A param tag can constrain its value with oneof, pattern, min, and max;
+//    a directive implementing ParamValidator checks its params together.
+//  - A param value may refer to a variable, max=${maxLen}, set with
+//    Tag.SetVariable or per call with WithVariables; $$ is a literal $.
 //
 // Lifecycle Hooks:
 //
@@ -54,9 +89,16 @@
 //
 // Concurrency:
 //
-//  - Once its directives are registered, a Tag is safe to share and to call
-//    ProcessStruct on from multiple goroutines; per-call state is kept off the
-//    shared directive instances.
-//  - RegisterDirective is the only mutating operation; register during setup,
-//    before processing concurrently.
+//  - Once it is set up, a Tag is safe to share and to call ProcessStruct on
+//    from multiple goroutines; per-call state is kept off the shared directive
+//    instances.
+//  - The registration functions (RegisterDirective and its variants,
+//    RegisterMacro, RegisterConverter, RegisterUnwrapper) and the setters
+//    (SetVariable, SetStrictParams, SetConvertUnderlying, SetInterfacePolicy,
+//    SetMaxDepth, SetCycleMode) mutate the Tag; call them during setup, before
+//    processing concurrently.
+//  - Each struct type's tags are compiled once per Tag and cached, so repeated
+//    ProcessStruct calls on the same type do not re-parse them. Every mutator
+//    except SetInterfacePolicy, SetMaxDepth, and SetCycleMode, which are read
+//    per call, discards the cached plans.
 package tagex
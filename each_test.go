@@ -0,0 +1,139 @@
+package tagex
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type lowerDirective struct{}
+
+func (d *lowerDirective) Name() string                      { return "lower" }
+func (d *lowerDirective) Mode() DirectiveMode               { return MutMode }
+func (d *lowerDirective) Handle(val string) (string, error) { return strings.ToLower(val), nil }
+
+func eachTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := chainTag(t)
+	MustRegisterDirective(tag, &lowerDirective{})
+	return tag
+}
+
+func TestEach_MutatesSliceAndArray(t *testing.T) {
+	tag := eachTag(t)
+
+	type post struct {
+		Tags  []string  `val:"each(trim;lower)"`
+		Pair  [2]string `val:"each(trim;lower)"`
+		Ptr   *[]string `val:"each(lower)"`
+		Empty []string  `val:"each(lower)"`
+	}
+	ptr := []string{"X"}
+	p := post{Tags: []string{" Go ", "REFLECT"}, Pair: [2]string{"A ", " b"}, Ptr: &ptr}
+	if err := tag.ProcessStruct(&p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(p.Tags, []string{"go", "reflect"}) {
+		t.Errorf("Tags = %q", p.Tags)
+	}
+	if p.Pair != [2]string{"a", "b"} {
+		t.Errorf("Pair = %q", p.Pair)
+	}
+	if ptr[0] != "x" {
+		t.Errorf("Ptr = %q", ptr)
+	}
+}
+
+func TestEach_MapKeysAndValues(t *testing.T) {
+	tag := eachTag(t)
+
+	type request struct {
+		Headers map[string]string `val:"keys(lower);values(trim)"`
+		Labels  map[string]string `val:"each(lower)"`
+	}
+	r := request{
+		Headers: map[string]string{"Content-Type": " json ", "accept": "xml"},
+		Labels:  map[string]string{"env": "PROD"},
+	}
+	if err := tag.ProcessStruct(&r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"content-type": "json", "accept": "xml"}
+	if !reflect.DeepEqual(r.Headers, want) {
+		t.Errorf("Headers = %q, want %q", r.Headers, want)
+	}
+	if r.Labels["env"] != "prod" {
+		t.Errorf("Labels = %q", r.Labels)
+	}
+}
+
+func TestEach_ErrorPathIndexesElement(t *testing.T) {
+	tag := eachTag(t)
+
+	type form struct {
+		Tags    []string          `val:"each(length, min=2, max=8)"`
+		Headers map[string]string `val:"values(length, min=0, max=3)"`
+		Grid    [][]string        `val:"each(each(length, min=1, max=2))"`
+	}
+	tests := []struct {
+		name string
+		f    form
+		want string
+	}{
+		{"slice", form{Tags: []string{"ok", "x"}}, "Tags[1]"},
+		{"map", form{Headers: map[string]string{"Accept": "json"}}, "Headers[Accept]"},
+		{"nested", form{Grid: [][]string{{"a"}, {"b", "ccc"}}}, "Grid[1][1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tag.ProcessStruct(&tt.f)
+			var pe *ProcessError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected *ProcessError, got %v", err)
+			}
+			if pe.FieldPath != tt.want || pe.Directive != "length" {
+				t.Errorf("FieldPath = %q, Directive = %q; want %q, \"length\"", pe.FieldPath, pe.Directive, tt.want)
+			}
+		})
+	}
+}
+
+func TestEach_WrongKind(t *testing.T) {
+	tag := eachTag(t)
+
+	type bad struct {
+		Name string   `val:"each(lower)"`
+		Tags []string `val:"keys(lower)"`
+	}
+	err := ProcessStructAll(&bad{Name: "x", Tags: []string{"y"}}, tag)
+	if n := countLeafErrors(err); n != 2 {
+		t.Fatalf("want 2 errors, got %d: %v", n, err)
+	}
+	var ge *GroupTypeError
+	if !errors.As(err, &ge) || ge.Group != "each" || ge.Type != reflect.TypeFor[string]() {
+		t.Errorf("expected *GroupTypeError for each on string, got %v", err)
+	}
+}
+
+// A group on an interface field is checked against the dynamic value.
+func TestEach_InterfaceCheckedAtRunTime(t *testing.T) {
+	tag := eachTag(t)
+
+	type holder struct {
+		V any `val:"each(lower)"`
+	}
+	h := holder{V: []string{"A"}}
+	if err := tag.ProcessStruct(&h); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := h.V.([]string)[0]; got != "a" {
+		t.Errorf("V[0] = %q, want %q", got, "a")
+	}
+
+	h = holder{V: 3}
+	var ge *GroupTypeError
+	if err := tag.ProcessStruct(&h); !errors.As(err, &ge) {
+		t.Errorf("expected *GroupTypeError, got %v", err)
+	}
+}
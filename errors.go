@@ -3,6 +3,8 @@ package tagex
 import (
 	"fmt"
 	"reflect"
+	"strings"
+	"unicode/utf8"
 )
 
 type Stage string
@@ -19,6 +21,9 @@ const (
 type ProcessError struct {
 	Stage     Stage
 	FieldPath string
+	// Macro is the macro the field's tag wrote, when the failure came from
+	// its expansion; Directive is then the directive within it that failed.
+	Macro     string
 	Directive string
 	Param     string
 	Cause     error
@@ -49,6 +54,9 @@ func (e *ProcessError) Error() string {
 	if e.FieldPath != "" {
 		msg += fmt.Sprintf(" field %q", e.FieldPath)
 	}
+	if e.Macro != "" {
+		msg += fmt.Sprintf(" macro %q", e.Macro)
+	}
 	if e.Directive != "" {
 		msg += fmt.Sprintf(" directive %q", e.Directive)
 	}
@@ -139,6 +147,49 @@ func (e *HandleError) Unwrap() error {
 	return e.Nested
 }
 
+// CrossFieldError wraps the error a directive's Handle (or HandleField)
+// returned for a field it compares with others through FieldRef params.
+// OtherPaths names the referenced fields the directive read before failing,
+// in the order it first read them, or all of its FieldRef params' fields if
+// it read none; OtherPath is the one it read last, usually the one it
+// compared against (the first, if it read none). The directive's own *HandleError is available through
+// Unwrap.
+type CrossFieldError struct {
+	FieldPath  string
+	OtherPath  string
+	OtherPaths []string
+	Err        error
+}
+
+func (e *CrossFieldError) Error() string {
+	if e == nil {
+		return "<nil>"
+	}
+	if len(e.OtherPaths) > 1 {
+		return fmt.Sprintf("field %q against %q: %v", e.FieldPath, e.OtherPaths, e.Err)
+	}
+	return fmt.Sprintf("field %q against %q: %v", e.FieldPath, e.OtherPath, e.Err)
+}
+
+func (e *CrossFieldError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// FieldRefError reports that a FieldRef param names no exported field of the
+// struct it is resolved against. It is found when a struct type's plan is
+// compiled and reported at StageParam.
+type FieldRefError struct {
+	Path   string
+	Reason string
+}
+
+func (e *FieldRefError) Error() string {
+	return fmt.Sprintf("unresolvable field reference %q: %s", e.Path, e.Reason)
+}
+
 type UnknownDirectiveError struct {
 	Name string
 }
@@ -147,18 +198,97 @@ func (e *UnknownDirectiveError) Error() string {
 	return fmt.Sprintf("unknown directive %q", e.Name)
 }
 
+// GroupTypeError reports that an element group was applied to a value it
+// can't range over: each(...) needs a slice, array, or map, and keys(...) and
+// values(...) need a map.
+type GroupTypeError struct {
+	Group string
+	Type  reflect.Type
+}
+
+func (e *GroupTypeError) Error() string {
+	want := "a slice, array, or map"
+	if e.Group != groupEach {
+		want = "a map"
+	}
+	return fmt.Sprintf("%s(...) needs %s, got %v", e.Group, want, e.Type)
+}
+
+// AnyError reports that every alternative of an any(...) failed. Errs holds
+// each alternative's error, in the order the alternatives are written; errors.Is
+// and errors.As see all of them.
+type AnyError struct {
+	Errs []error
+}
+
+func (e *AnyError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "none of %d alternatives passed", len(e.Errs))
+	for i, err := range e.Errs {
+		fmt.Fprintf(&b, "; %d: %v", i+1, err)
+	}
+	return b.String()
+}
+
+func (e *AnyError) Unwrap() []error { return e.Errs }
+
+// NegationError reports that the chain inside a not(...) passed.
+type NegationError struct {
+	Chain string
+}
+
+func (e *NegationError) Error() string {
+	return fmt.Sprintf("value must not satisfy %q", e.Chain)
+}
+
+// UnwrapperError reports that a function passed to RegisterUnwrapper didn't
+// return a non-nil pointer to the wrapped value for a zero Type.
+type UnwrapperError struct {
+	Type reflect.Type
+}
+
+func (e *UnwrapperError) Error() string {
+	return fmt.Sprintf("unwrapper for %v must return a non-nil pointer to the wrapped value", e.Type)
+}
+
+// ConditionParseError reports a when(...) or unless(...) condition that
+// doesn't parse, or whose field can't be resolved against the struct. Err is
+// the underlying *FieldRefError for an unknown field.
+type ConditionParseError struct {
+	Condition string
+	Reason    string
+	Err       error
+}
+
+func (e *ConditionParseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid condition %q: %s: %v", e.Condition, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("invalid condition %q: %s", e.Condition, e.Reason)
+}
+
+func (e *ConditionParseError) Unwrap() error {
+	return e.Err
+}
+
 type EmptyDirectiveNameError struct{}
 
 func (e *EmptyDirectiveNameError) Error() string {
 	return "directive name must not be empty"
 }
 
+// DuplicateDirectiveError reports that a directive with the same name and
+// field type T is already registered on the tag. Type is that T.
 type DuplicateDirectiveError struct {
 	Name string
+	Type reflect.Type
 }
 
 func (e *DuplicateDirectiveError) Error() string {
-	return fmt.Sprintf("directive %q is already registered", e.Name)
+	if e.Type == nil {
+		return fmt.Sprintf("directive %q is already registered", e.Name)
+	}
+	return fmt.Sprintf("directive %q is already registered for %v", e.Name, e.Type)
 }
 
 // MaxDepthError reports that processing recursed past the nesting limit, which
@@ -173,6 +303,47 @@ func (e *MaxDepthError) Error() string {
 	return fmt.Sprintf("maximum nesting depth %d exceeded (possible cycle)", e.Limit)
 }
 
+// CycleError reports that processing reached a pointer, map, or slice that is
+// already on the current walk path, i.e. the data is cyclic. Path is where the
+// node was reached again and FirstPath where it was first entered ("" for the
+// processed struct itself). It is only returned by a Tag set to CycleReport (see
+// SetCycleMode), wrapped in a *ProcessError whose FieldPath is Path.
+type CycleError struct {
+	Path      string
+	FirstPath string
+}
+
+func (e *CycleError) Error() string {
+	first := e.FirstPath
+	if first == "" {
+		first = "(root)"
+	}
+	return fmt.Sprintf("cycle: %q refers back to %q", e.Path, first)
+}
+
+// ContextError reports that processing stopped because its context was
+// cancelled or its deadline passed. Err is ctx.Err(), so errors.Is matches
+// context.Canceled and context.DeadlineExceeded through it. Like other
+// processing failures it is wrapped in a *ProcessError, whose FieldPath locates
+// where processing stopped.
+type ContextError struct {
+	Err error
+}
+
+func (e *ContextError) Error() string {
+	if e == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("processing stopped: %v", e.Err)
+}
+
+func (e *ContextError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.Err
+}
+
 // InvalidTargetError reports that the value passed to ProcessStruct was not a
 // pointer to a struct. Got is its concrete type.
 type InvalidTargetError struct {
@@ -190,20 +361,111 @@ func (e *NilTagError) Error() string {
 	return "nil tag provided"
 }
 
+// DirectiveParseError reports a segment with no directive name, as in
+// "trim;, min=3", or, with Reason set, one that is otherwise malformed, as in
+// the unclosed group "each(trim;lower". TagValue is the segment; Position
+// locates the fault.
 type DirectiveParseError struct {
 	TagValue string
+	Reason   string
+	Position
 }
 
 func (e *DirectiveParseError) Error() string {
-	return "directive name is required"
+	if e.Reason != "" {
+		return fmt.Sprintf("malformed directive %q: %s", e.TagValue, e.Reason) + e.Position.suffix()
+	}
+	return "directive name is required" + e.Position.suffix()
 }
 
+// ParamParseError reports an arg that isn't a key=value pair. Pair is the arg;
+// Position locates it.
 type ParamParseError struct {
 	Pair string
+	// Suggestion is, under SetStrictParams, the flag param closest to a bare
+	// arg no param takes, if any is close.
+	Suggestion string
+	Position
 }
 
 func (e *ParamParseError) Error() string {
-	return fmt.Sprintf("malformed key value pair %q, expected format is \"key=value\"", e.Pair)
+	msg := fmt.Sprintf("malformed key value pair %q, expected format is \"key=value\"", e.Pair)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", e.Suggestion)
+	}
+	return msg + e.Position.suffix()
+}
+
+// Position locates a parse error in the text being parsed. Source is that
+// text: the tag value, or for a macro the expanded chain. Segment is the index
+// of the ';' segment of Source holding the error, counted as Parse counts
+// Chain.Segments. Offset and Len are the byte offset and length in Source of
+// the text at fault. The zero Position means the location is unknown.
+type Position struct {
+	Source      string
+	Segment     int
+	Offset, Len int
+}
+
+// Excerpt returns Source with a line of carets under the text at fault:
+//
+//	trim;length, min=,max=3
+//	             ^^^^
+//
+// It returns "" for the zero Position.
+func (p Position) Excerpt() string {
+	if p.Source == "" || p.Offset < 0 || p.Offset > len(p.Source) {
+		return ""
+	}
+	end := min(p.Offset+max(p.Len, 1), len(p.Source))
+	pad := utf8.RuneCountInString(p.Source[:p.Offset])
+	carets := max(utf8.RuneCountInString(p.Source[p.Offset:end]), 1)
+	return p.Source + "\n" + strings.Repeat(" ", pad) + strings.Repeat("^", carets)
+}
+
+func (p Position) suffix() string {
+	if p.Source == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (segment %d, offset %d)", p.Segment, p.Offset)
+}
+
+// UnknownParamError reports an arg that names no param: for a macro, one that
+// none of its placeholders uses, and under SetStrictParams, one that no
+// param-tagged field of the directive declares. Suggestion is the closest
+// declared name, or "" if none is close.
+type UnknownParamError struct {
+	Param      string
+	Suggestion string
+}
+
+func (e *UnknownParamError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("unknown parameter %q (did you mean %q?)", e.Param, e.Suggestion)
+	}
+	return fmt.Sprintf("unknown parameter %q", e.Param)
+}
+
+// DuplicateParamError reports, under SetStrictParams, a key given more than
+// once in one segment. Position locates the repeat.
+type DuplicateParamError struct {
+	Param string
+	Position
+}
+
+func (e *DuplicateParamError) Error() string {
+	return fmt.Sprintf("parameter %q given more than once", e.Param) + e.Position.suffix()
+}
+
+// MacroCycleError reports that RegisterMacro was given an expansion that
+// reaches the macro being registered again. Cycle is the path of macro names,
+// starting and ending with it.
+type MacroCycleError struct {
+	Cycle []string
+}
+
+func (e *MacroCycleError) Error() string {
+	return fmt.Sprintf("macro cycle: %s", strings.Join(e.Cycle, " -> "))
 }
 
 type MissingParamError struct {
@@ -214,25 +476,57 @@ func (e *MissingParamError) Error() string {
 	return fmt.Sprintf("%q parameter not set", e.Param)
 }
 
+// TypeMismatchError reports a directive applied to a value of a type it doesn't
+// handle. Expected is the value's type and Got the directive's T. When the
+// directive name has several overloads and none handles the type, Got is nil
+// and Available lists the overloads' types. Reason, when set, says why no
+// named-type conversion applied (see Tag.SetConvertUnderlying).
 type TypeMismatchError struct {
-	Expected reflect.Type
-	Got      reflect.Type
+	Expected  reflect.Type
+	Got       reflect.Type
+	Available []reflect.Type
+	Reason    string
 }
 
 func (e *TypeMismatchError) Error() string {
+	if len(e.Available) > 0 {
+		names := make([]string, len(e.Available))
+		for i, t := range e.Available {
+			names[i] = t.String()
+		}
+		if e.Reason != "" {
+			return fmt.Sprintf("type mismatch: %v against overloads %s: %s", e.Expected, strings.Join(names, ", "), e.Reason)
+		}
+		return fmt.Sprintf("type mismatch: no overload for %v, available: %s", e.Expected, strings.Join(names, ", "))
+	}
+	if e.Reason != "" {
+		return fmt.Sprintf("type mismatch: expected %v, got %v: %s", e.Expected, e.Got, e.Reason)
+	}
 	return fmt.Sprintf("type mismatch: expected %v, got %v", e.Expected, e.Got)
 }
 
+// ConversionError reports a param value that can't be converted to its
+// field's type. Raw is the value (or, in a list or map, the element) at fault
+// and Target the type it was converted to. Err is the underlying error, when
+// a TextUnmarshaler or a registered converter gave one.
 type ConversionError struct {
 	Param  string
 	Raw    string
 	Target string
+	Err    error
 }
 
 func (e *ConversionError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf(msg, e.Raw, e.Target) + ": " + e.Err.Error()
+	}
 	return fmt.Sprintf(msg, e.Raw, e.Target)
 }
 
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
 func NewConversionError(field reflect.StructField, raw string, target string) *ConversionError {
 	return &ConversionError{
 		Param:  field.Tag.Get(paramKey),
@@ -265,10 +559,43 @@ func (e *UnsupportedParamTypeError) Error() string {
 	return fmt.Sprintf("unsupported param type %s", e.Type)
 }
 
-type ParamConflictError struct {
+// UnknownVariableError reports a ${Name} reference, in the value given for
+// Param, to a variable neither the call nor the Tag sets.
+type UnknownVariableError struct {
+	Name  string
 	Param string
 }
 
+func (e *UnknownVariableError) Error() string {
+	return fmt.Sprintf("unknown variable %q in %q param", e.Name, e.Param)
+}
+
+// ParamConstraintError reports a param value that violates a constraint of its
+// param tag (oneof, min, max, pattern), or that a ParamValidator rejects.
+// Value is the value as given and Constraint the rule it breaks, such as
+// "max=80".
+type ParamConstraintError struct {
+	Param      string
+	Value      string
+	Constraint string
+}
+
+func (e *ParamConstraintError) Error() string {
+	return fmt.Sprintf("%q param value %q violates %s", e.Param, e.Value, e.Constraint)
+}
+
+// ParamConflictError reports a param declared or given in contradictory ways:
+// a param tag with both required and default, a flag, variadic, or bounded
+// param on the wrong field type, min above max, two params at one position,
+// or an arg given both by position and by name. Reason says which; it is "" for required and default.
+type ParamConflictError struct {
+	Param  string
+	Reason string
+}
+
 func (e *ParamConflictError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%q param: %s", e.Param, e.Reason)
+	}
 	return fmt.Sprintf("%q param cannot set both required and default", e.Param)
 }
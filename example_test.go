@@ -187,3 +187,22 @@ func Example_quotedValue() {
 	fmt.Println(line.Text)
 	// Output: [a, b; c] hello
 }
+
+// ExampleParse reads a tag value as a syntax tree and prints it back in
+// canonical form.
+func ExampleParse() {
+	c, err := Parse(`trim ; length, min = 3, max='a,b' ;each( lower )`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, sg := range c.Segments {
+		fmt.Println(sg.Name, len(sg.Args))
+	}
+	fmt.Println(c)
+	// Output:
+	// trim 0
+	// length 2
+	// each 0
+	// trim;length, min=3, max='a,b';each(lower)
+}
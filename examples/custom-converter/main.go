@@ -1,5 +1,6 @@
 // Custom-converter shows a directive that implements ParamConverter to accept a
-// parameter type the default converter doesn't handle (here, a []int).
+// parameter format the default converter doesn't (here, a '|'-separated []int;
+// DefaultConvert would want '1,2,3').
 package main
 
 import (
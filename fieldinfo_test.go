@@ -0,0 +1,95 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// emailDirective reports failures by the field's JSON name, or its label tag
+// when present, and records every FieldInfo it is handed.
+type emailDirective struct {
+	seen *[]FieldInfo
+}
+
+func (d *emailDirective) Name() string                      { return "email" }
+func (d *emailDirective) Mode() DirectiveMode               { return EvalMode }
+func (d *emailDirective) Handle(val string) (string, error) { return val, nil }
+func (d *emailDirective) HandleField(_ context.Context, val string, field FieldInfo) (string, error) {
+	*d.seen = append(*d.seen, field)
+	if strings.Contains(val, "@") {
+		return val, nil
+	}
+	name := field.TagName("json")
+	if label, ok := field.Field.Tag.Lookup("label"); ok {
+		name = label
+	}
+	return val, fmt.Errorf("%s must be valid", name)
+}
+
+func TestFieldDirective_ReceivesFieldInfo(t *testing.T) {
+	var seen []FieldInfo
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &emailDirective{seen: &seen})
+
+	type contact struct {
+		Email string `json:"email,omitempty" val:"email"`
+	}
+	type form struct {
+		Primary  string `json:"primary" label:"E-mail" val:"email"`
+		Contacts []contact
+	}
+	f := form{Primary: "nope", Contacts: []contact{{Email: "a@b"}, {Email: "bad"}}}
+	err := ProcessStructAll(&f, tag)
+	if n := countLeafErrors(err); n != 2 {
+		t.Fatalf("want 2 errors, got %d: %v", n, err)
+	}
+
+	msgs := make([]string, 0, 2)
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var he *HandleError
+		if !errors.As(e, &he) {
+			t.Fatalf("expected *HandleError, got %v", e)
+		}
+		msgs = append(msgs, he.Error())
+	}
+	if msgs[0] != "E-mail must be valid" || msgs[1] != "email must be valid" {
+		t.Errorf("messages = %q", msgs)
+	}
+
+	if len(seen) != 3 {
+		t.Fatalf("want 3 FieldInfo, got %d", len(seen))
+	}
+	last := seen[2]
+	if last.Path != "Contacts[1].Email" {
+		t.Errorf("Path = %q, want %q", last.Path, "Contacts[1].Email")
+	}
+	if last.TagKey != valTagKey {
+		t.Errorf("TagKey = %q, want %q", last.TagKey, valTagKey)
+	}
+	if last.Field.Name != "Email" {
+		t.Errorf("Field.Name = %q, want %q", last.Field.Name, "Email")
+	}
+	if got := last.Parent.Interface(); got != (contact{Email: "bad"}) {
+		t.Errorf("Parent = %#v, want the enclosing contact", got)
+	}
+}
+
+func TestFieldInfo_TagNameFallsBack(t *testing.T) {
+	type s struct {
+		A string `json:"a"`
+		B string `json:"-"`
+		C string `json:",omitempty"`
+		D string
+	}
+	typ := reflect.TypeFor[s]()
+	for i, want := range []string{"a", "B", "C", "D"} {
+		info := FieldInfo{Field: typ.Field(i)}
+		if got := info.TagName("json"); got != want {
+			t.Errorf("field %d: TagName = %q, want %q", i, got, want)
+		}
+	}
+}
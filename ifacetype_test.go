@@ -0,0 +1,150 @@
+package tagex
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type color int
+
+func (c color) String() string { return [...]string{"", "red", "green"}[c] }
+
+// level implements encoding.TextMarshaler through its pointer only.
+type level struct{ name string }
+
+func (l *level) MarshalText() ([]byte, error) { return []byte(l.name), nil }
+
+type nonblankText struct{}
+
+func (d *nonblankText) Name() string        { return "nonblank" }
+func (d *nonblankText) Mode() DirectiveMode { return EvalMode }
+func (d *nonblankText) Handle(val encoding.TextMarshaler) (encoding.TextMarshaler, error) {
+	if b, err := val.MarshalText(); err != nil || len(b) == 0 {
+		return val, errors.New("must not be blank")
+	}
+	return val, nil
+}
+
+type nonblankString struct{}
+
+func (d *nonblankString) Name() string        { return "nonblank" }
+func (d *nonblankString) Mode() DirectiveMode { return EvalMode }
+func (d *nonblankString) Handle(val fmt.Stringer) (fmt.Stringer, error) {
+	if val.String() == "" {
+		return val, errors.New("must not be blank")
+	}
+	return val, nil
+}
+
+// swapStringer is a MutMode directive returning whatever ret yields.
+type swapStringer struct {
+	ret func(fmt.Stringer) fmt.Stringer
+}
+
+func (d *swapStringer) Name() string        { return "swap" }
+func (d *swapStringer) Mode() DirectiveMode { return MutMode }
+func (d *swapStringer) Handle(val fmt.Stringer) (fmt.Stringer, error) {
+	return d.ret(val), nil
+}
+
+func TestInterfaceT_Eval(t *testing.T) {
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &nonblankText{})
+
+	type settings struct {
+		Level  level   `val:"nonblank"` // via &Level
+		Levels []level `val:"each(nonblank)"`
+	}
+	if err := tag.ProcessStruct(&settings{Level: level{"info"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := tag.ProcessStruct(&settings{Level: level{"info"}, Levels: []level{{"debug"}, {}}})
+	var pe *ProcessError
+	if !errors.As(err, &pe) || pe.FieldPath != "Levels[1]" {
+		t.Errorf("want failure at Levels[1], got %v", err)
+	}
+
+	type notImpl struct {
+		N int `val:"nonblank"`
+	}
+	var tm *TypeMismatchError
+	if err := tag.ProcessStruct(&notImpl{}); !errors.As(err, &tm) {
+		t.Errorf("expected *TypeMismatchError, got %v", err)
+	}
+}
+
+func TestInterfaceT_MutModeWriteBack(t *testing.T) {
+	type palette struct {
+		Main color        `val:"swap"`
+		Any  fmt.Stringer `val:"swap"`
+	}
+	tests := []struct {
+		name    string
+		ret     func(fmt.Stringer) fmt.Stringer
+		want    palette
+		wantErr bool
+	}{
+		{"same type", func(fmt.Stringer) fmt.Stringer { return color(2) }, palette{Main: 2, Any: color(2)}, false},
+		{"other type", func(fmt.Stringer) fmt.Stringer { return bothText{} }, palette{Main: 1, Any: color(1)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag := NewTag(valTagKey)
+			MustRegisterDirective(tag, &swapStringer{ret: tt.ret})
+			p := palette{Main: 1, Any: color(1)}
+			err := tag.ProcessStruct(&p)
+			var tm *TypeMismatchError
+			if tt.wantErr != errors.As(err, &tm) {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if p.Main != tt.want.Main {
+				t.Errorf("Main = %v, want %v", p.Main, tt.want.Main)
+			}
+		})
+	}
+
+	// A nil result zeroes a field that can hold nil.
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &swapStringer{ret: func(fmt.Stringer) fmt.Stringer { return nil }})
+	type holder struct {
+		Any fmt.Stringer `val:"swap"`
+	}
+	h := holder{Any: color(1)}
+	if err := tag.ProcessStruct(&h); err != nil || h.Any != nil {
+		t.Errorf("Any = %v, err = %v; want nil, nil", h.Any, err)
+	}
+}
+
+func TestInterfaceT_Overloads(t *testing.T) {
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &nonblankText{})
+	MustRegisterDirective(tag, &nonblankString{})
+
+	type ok struct {
+		C color `val:"nonblank"`
+		L level `val:"nonblank"`
+	}
+	err := ProcessStructAll(&ok{}, tag)
+	if n := countLeafErrors(err); n != 2 {
+		t.Fatalf("want 2 errors (one per overload), got %d: %v", n, err)
+	}
+	var he *HandleError
+	if !errors.As(err, &he) {
+		t.Errorf("expected *HandleError, got %v", err)
+	}
+
+	type both struct {
+		B bothText `val:"nonblank"`
+	}
+	var tm *TypeMismatchError
+	if err := tag.ProcessStruct(&both{}); !errors.As(err, &tm) || tm.Reason == "" {
+		t.Errorf("expected an ambiguous *TypeMismatchError, got %v", err)
+	}
+}
+
+type bothText struct{}
+
+func (bothText) String() string               { return "x" }
+func (bothText) MarshalText() ([]byte, error) { return []byte("x"), nil }
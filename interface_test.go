@@ -0,0 +1,107 @@
+package tagex
+
+import (
+	"errors"
+	"testing"
+)
+
+type event interface{ kind() string }
+
+type created struct {
+	N int `mul:"mul, factor=2" val:"range, min=0, max=100"`
+}
+
+func (*created) kind() string { return "created" }
+
+type envelope struct {
+	Payload any
+	Event   event
+}
+
+func ifaceTags(t *testing.T) (*Tag, *Tag) {
+	t.Helper()
+	mulTag := NewTag("mul")
+	MustRegisterDirective(mulTag, &MultiplyDirective{})
+	valTag := NewTag(valTagKey)
+	MustRegisterDirective(valTag, &RangeDirective{})
+	return mulTag, valTag
+}
+
+func TestProcessStruct_Interface_PointerMutates(t *testing.T) {
+	mulTag, _ := ifaceTags(t)
+
+	p, e := &created{N: 2}, &created{N: 5}
+	env := envelope{Payload: p, Event: e}
+	if err := mulTag.ProcessStruct(&env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.N != 4 || e.N != 10 {
+		t.Errorf("expected writes through the pointers, got Payload.N=%d Event.N=%d", p.N, e.N)
+	}
+}
+
+func TestProcessStruct_Interface_ErrorPathMarksDynamicType(t *testing.T) {
+	_, valTag := ifaceTags(t)
+
+	env := envelope{Payload: []*created{{N: 1}, {N: 500}}}
+	err := valTag.ProcessStruct(&env)
+	var pe *ProcessError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *ProcessError, got %v", err)
+	}
+	if want := "Payload.([]*tagex.created)[1].N"; pe.FieldPath != want {
+		t.Errorf("FieldPath = %q, want %q", pe.FieldPath, want)
+	}
+}
+
+func TestProcessStruct_Interface_NilSkipped(t *testing.T) {
+	mulTag, _ := ifaceTags(t)
+	if err := mulTag.ProcessStruct(&envelope{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProcessStruct_Interface_NonAddressablePolicy(t *testing.T) {
+	tests := []struct {
+		policy  InterfacePolicy
+		want    int
+		wantErr bool
+	}{
+		{InterfaceCopy, 6, true},
+		{InterfaceEval, 3, true},
+		{InterfaceSkip, 3, false},
+	}
+	for _, tt := range tests {
+		mulTag, valTag := ifaceTags(t)
+		mulTag.SetInterfacePolicy(tt.policy)
+		valTag.SetInterfacePolicy(tt.policy)
+
+		// A struct value in an interface is a copy the walk cannot address.
+		env := envelope{Payload: created{N: 3}}
+		if err := mulTag.ProcessStruct(&env); err != nil {
+			t.Fatalf("policy %d: unexpected error: %v", tt.policy, err)
+		}
+		if got := env.Payload.(created).N; got != tt.want {
+			t.Errorf("policy %d: N = %d, want %d", tt.policy, got, tt.want)
+		}
+
+		bad := envelope{Payload: created{N: 500}}
+		if err := valTag.ProcessStruct(&bad); (err != nil) != tt.wantErr {
+			t.Errorf("policy %d: err = %v, wantErr %v", tt.policy, err, tt.wantErr)
+		}
+	}
+}
+
+// Tags processed together share one walk; the most conservative policy wins.
+func TestProcessStruct_Interface_MergedPolicy(t *testing.T) {
+	mulTag, valTag := ifaceTags(t)
+	valTag.SetInterfacePolicy(InterfaceEval)
+
+	env := envelope{Payload: created{N: 3}}
+	if err := ProcessStruct(&env, mulTag, valTag); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := env.Payload.(created).N; got != 3 {
+		t.Errorf("N = %d, want 3 (InterfaceEval discards the copy)", got)
+	}
+}
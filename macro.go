@@ -0,0 +1,234 @@
+package tagex
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// This file implements macros: named chains registered on a Tag and written in
+// a tag value like a directive.
+//
+//	tag.RegisterMacro("username", "trim;lower;length, min=${min=3}, max=${max=32}")
+//	// val:"username"          -> trim;lower;length, min=3, max=32
+//	// val:"username, max=20"  -> trim;lower;length, min=3, max=20
+//
+// A macro segment's args fill the ${name} placeholders in its expansion, and
+// ${name=default} gives a placeholder a default. $$ in an expansion is a $,
+// so $${name} is left as a variable reference (see SetVariable). The expanded text is then
+// compiled like any other chain, so it may use groups, conditions, and other
+// macros.
+
+// macroPlan is a compiled macro segment: the chain its expansion compiles to,
+// or the error found expanding it.
+type macroPlan struct {
+	name  string
+	chain chainPlan
+	err   *ProcessError
+}
+
+// RegisterMacro registers expansion on t under name, so that a tag value can
+// write name in place of the chain. It returns an *EmptyDirectiveNameError if
+// name is blank, a *DuplicateDirectiveError if name is already a directive or
+// macro on t, and a *MacroCycleError if expansion reaches name again, directly
+// or through other macros.
+func (t *Tag) RegisterMacro(name, expansion string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return &EmptyDirectiveNameError{}
+	}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if _, exists := t.directiveRegistry[name]; exists {
+		return &DuplicateDirectiveError{Name: name}
+	}
+	if _, exists := t.macros[name]; exists {
+		return &DuplicateDirectiveError{Name: name}
+	}
+	if cycle := t.macroCycle(name, expansion, []string{name}); cycle != nil {
+		return &MacroCycleError{Cycle: cycle}
+	}
+	if t.macros == nil {
+		t.macros = make(map[string]string)
+	}
+	t.macros[name] = expansion
+	t.resetPlans()
+	return nil
+}
+
+// MustRegisterMacro is like RegisterMacro but panics if registration fails.
+func (t *Tag) MustRegisterMacro(name, expansion string) {
+	if err := t.RegisterMacro(name, expansion); err != nil {
+		panic(err)
+	}
+}
+
+// macroCycle reports the path by which expansion, reached through path, names
+// path[0] again, or nil if it doesn't. The caller holds t.mut.
+func (t *Tag) macroCycle(root, expansion string, path []string) []string {
+	for _, name := range chainNames(expansion) {
+		if name == root {
+			return append(path, name)
+		}
+		next, ok := t.macros[name]
+		if !ok || contains(path, name) {
+			continue
+		}
+		if cycle := t.macroCycle(root, next, append(path, name)); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// chainNames lists the directive and macro names a chain refers to, looking
+// inside groups, conditions, and combinators.
+func chainNames(chain string) []string {
+	var names []string
+	segs, _ := cutOmitEmpty(wholeSpan(chain).chain())
+	for _, seg := range segs {
+		if op, inner, ok := seg.group(); ok {
+			switch {
+			case isGroup(op), isCombinator(op):
+				names = append(names, chainNames(inner.text)...)
+				continue
+			case isCondition(op):
+				if _, rest, ok := inner.cutCondition(); ok {
+					names = append(names, chainNames(rest.text)...)
+				}
+				continue
+			}
+		}
+		if name, _, err := parseDirective(seg); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// compileMacro expands the macro name with args, parsed from seg, and compiles
+// the result for a value of type typ in the struct type parent. A macro takes
+// key=value args only.
+func compileMacro(tag *Tag, name, expansion string, seg span, args []Arg, typ, parent reflect.Type) *macroPlan {
+	if err := checkNamedArgs(seg, args); err != nil {
+		return &macroPlan{name: name, err: &ProcessError{
+			Stage: StageParam,
+			Macro: name,
+			Cause: err,
+		}}
+	}
+	expanded, param, err := expandMacro(expansion, argMap(args))
+	if err != nil {
+		return &macroPlan{name: name, err: &ProcessError{
+			Stage: StageParam,
+			Macro: name,
+			Param: param,
+			Cause: err,
+		}}
+	}
+	return &macroPlan{name: name, chain: compileChain(tag, wholeSpan(expanded), typ, parent)}
+}
+
+// expandMacro substitutes args into the placeholders of expansion. An arg is
+// quoted as the grammar requires where it lands, so a value holding ',' or ';'
+// stays one value. It fails, naming the param, for a placeholder with neither
+// an arg nor a default, and for an arg no placeholder uses.
+func expandMacro(expansion string, args map[string]string) (string, string, error) {
+	var b strings.Builder
+	used := make(map[string]bool)
+	inQuote := false
+	for i := 0; i < len(expansion); i++ {
+		c := expansion[i]
+		switch {
+		case c == quote:
+			if inQuote && i+1 < len(expansion) && expansion[i+1] == quote {
+				b.WriteString("''")
+				i++
+				continue
+			}
+			inQuote = !inQuote
+		case c == '$' && strings.HasPrefix(expansion[i:], "$$"):
+			// An escaped $: $${name} is left as ${name}, a variable.
+			b.WriteByte('$')
+			i++
+			continue
+		case c == '$' && strings.HasPrefix(expansion[i:], "${"):
+			end := strings.IndexByte(expansion[i:], '}')
+			if end < 0 {
+				break
+			}
+			name, def, hasDef := strings.Cut(expansion[i+2:i+end], "=")
+			name = strings.TrimSpace(name)
+			used[name] = true
+			i += end
+			if v, ok := args[name]; ok {
+				if inQuote {
+					b.WriteString(strings.ReplaceAll(v, "'", "''"))
+				} else {
+					b.WriteString(quoteValue(v))
+				}
+				continue
+			}
+			if !hasDef {
+				return "", name, &MissingParamError{Param: name}
+			}
+			b.WriteString(def)
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !used[k] {
+			placeholders := make([]string, 0, len(used))
+			for name := range used {
+				placeholders = append(placeholders, name)
+			}
+			sort.Strings(placeholders)
+			return "", k, &UnknownParamError{Param: k, Suggestion: closest(k, placeholders)}
+		}
+	}
+	return b.String(), "", nil
+}
+
+// quoteValue returns v as it must be written as an unquoted tag value: as is
+// when it holds nothing the grammar reserves, else single-quoted with interior
+// quotes doubled.
+func quoteValue(v string) string {
+	if v != "" && v == strings.TrimSpace(v) && !strings.ContainsAny(v, ",;=():'") {
+		return v
+	}
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
+
+// run runs the macro's chain, marking its errors with the macro's name. An
+// enclosing macro runs last and so names itself: errors report the macro the
+// field's tag wrote.
+func (m *macroPlan) run(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	if m.err != nil {
+		e := *m.err
+		return &e
+	}
+	err := m.chain.run(ctx, val, field)
+	if pe, ok := err.(*ProcessError); ok {
+		pe.Macro = m.name
+	}
+	return err
+}
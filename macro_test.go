@@ -0,0 +1,113 @@
+package tagex
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func macroTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := eachTag(t)
+	MustRegisterDirective(tag, &rxCapture{})
+	tag.MustRegisterMacro("username", "trim;lower;length, min=${min=3}, max=${max=32}")
+	tag.MustRegisterMacro("handle", "username, max=${max}")
+	return tag
+}
+
+func TestMacro_Expands(t *testing.T) {
+	tag := macroTag(t)
+
+	type user struct {
+		Name  string   `val:"username"`
+		Short string   `val:"username, max=4"`
+		Alias string   `val:"handle, max=5"`
+		Tags  []string `val:"each(username)"`
+	}
+	u := user{Name: "  Ann_1 ", Short: "Bob", Alias: "Carla", Tags: []string{" DAN "}}
+	if err := tag.ProcessStruct(&u); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.Name != "ann_1" || u.Tags[0] != "dan" {
+		t.Errorf("Name = %q, Tags = %q", u.Name, u.Tags)
+	}
+
+	u.Short = "Bobby"
+	err := tag.ProcessStruct(&u)
+	var pe *ProcessError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *ProcessError, got %v", err)
+	}
+	if pe.Macro != "username" || pe.Directive != "length" || pe.FieldPath != "Short" {
+		t.Errorf("Macro = %q, Directive = %q, FieldPath = %q", pe.Macro, pe.Directive, pe.FieldPath)
+	}
+	if want := `directive processing field "Short" macro "username" directive "length"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("message = %q", err.Error())
+	}
+}
+
+// Args are quoted where they land, so reserved characters survive.
+func TestMacro_ArgsKeepQuoting(t *testing.T) {
+	var got string
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &rxCapture{seen: &got})
+	tag.MustRegisterMacro("rx", "regex, pattern=${p}")
+	tag.MustRegisterMacro("rxq", "regex, pattern='^${p}$'")
+
+	tests := []struct{ tagValue, want string }{
+		{`rx, p='a,b;c'`, "a,b;c"},
+		{`rxq, p='it''s'`, "^it's$"},
+	}
+	for _, tt := range tests {
+		s := "x"
+		if err := processDirective(tag, tt.tagValue, reflect.ValueOf(&s).Elem()); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.tagValue, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: pattern = %q, want %q", tt.tagValue, got, tt.want)
+		}
+	}
+}
+
+func TestMacro_ParamErrors(t *testing.T) {
+	tag := macroTag(t)
+
+	type missing struct {
+		Alias string `val:"handle"`
+	}
+	type unknown struct {
+		Name string `val:"username, mx=3"`
+	}
+	var pe *ProcessError
+	var mp *MissingParamError
+	if err := tag.ProcessStruct(&missing{}); !errors.As(err, &mp) || !errors.As(err, &pe) || pe.Param != "max" || pe.Macro != "handle" {
+		t.Errorf("missing: got %v", err)
+	}
+	var up *UnknownParamError
+	if err := tag.ProcessStruct(&unknown{}); !errors.As(err, &up) || up.Param != "mx" || !errors.As(err, &pe) || pe.Stage != StageParam {
+		t.Errorf("unknown: got %v", err)
+	}
+}
+
+func TestRegisterMacro_Errors(t *testing.T) {
+	tag := macroTag(t)
+
+	var dup *DuplicateDirectiveError
+	if err := tag.RegisterMacro("trim", "lower"); !errors.As(err, &dup) {
+		t.Errorf("macro named like a directive: got %v", err)
+	}
+	if err := tag.RegisterMacro("username", "trim"); !errors.As(err, &dup) {
+		t.Errorf("duplicate macro: got %v", err)
+	}
+
+	var cyc *MacroCycleError
+	if err := tag.RegisterMacro("self", "trim;each(self)"); !errors.As(err, &cyc) {
+		t.Errorf("self reference: got %v", err)
+	}
+	tag.MustRegisterMacro("a", "trim;b")
+	err := tag.RegisterMacro("b", "when(Name: a)")
+	if !errors.As(err, &cyc) || !reflect.DeepEqual(cyc.Cycle, []string{"b", "a", "b"}) {
+		t.Errorf("indirect cycle: got %v", err)
+	}
+}
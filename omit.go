@@ -0,0 +1,53 @@
+package tagex
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// This file implements the omitempty modifier. Written at the start of a
+// chain, it skips the rest of the chain when the value is zero:
+//
+//	omitempty;length, min=3
+//	?;length, min=3
+//	?length, min=3
+//
+// "?" is shorthand for omitempty and may be written on its own or glued to the
+// first directive. The modifier applies to the chain it starts, so inside
+// each(...) it skips zero elements, and inside a macro it skips the macro's
+// expansion only.
+
+const omitEmpty = "omitempty"
+
+// omitPlan runs chain unless the value is zero.
+type omitPlan struct {
+	chain chainPlan
+}
+
+// cutOmitEmpty reports whether segs, trimmed as span.chain returns them,
+// starts with the omitempty modifier and returns the segments after it.
+func cutOmitEmpty(segs []span) ([]span, bool) {
+	if len(segs) == 0 {
+		return segs, false
+	}
+	first := segs[0]
+	switch {
+	case first.text == omitEmpty, first.text == "?":
+		return segs[1:], true
+	case strings.HasPrefix(first.text, "?"):
+		rest := span{src: first.src, text: first.text[1:], pos: first.pos + 1}.trim()
+		return append([]span{rest}, segs[1:]...), true
+	}
+	return segs, false
+}
+
+// run skips the chain for a zero value (reflect.Value.IsZero): an empty
+// string, 0, false, a nil pointer, slice, map, or interface, or a struct whose
+// fields are all zero. A non-nil pointer to a zero value is not zero.
+func (o *omitPlan) run(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	if !val.IsValid() || val.IsZero() {
+		return nil
+	}
+	return o.chain.run(ctx, val, field)
+}
@@ -0,0 +1,76 @@
+package tagex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type profile struct {
+	Bio     string   `val:"omitempty;length, min=3, max=10"`
+	Age     int      `val:"?range, min=18, max=150"`
+	Email   *string  `val:"?;present"`
+	Aliases []string `val:"each(?length, min=3, max=10)"`
+}
+
+func TestOmitEmpty_SkipsZeroValues(t *testing.T) {
+	tag := derefTag(t)
+	if err := tag.ProcessStruct(&profile{Aliases: []string{"", "ann"}}); err != nil {
+		t.Fatalf("zero values should skip their chains, got %v", err)
+	}
+}
+
+// A set value still runs the whole chain, and every failure is reported under
+// ProcessStructAll.
+func TestOmitEmpty_ValidatesSetValues(t *testing.T) {
+	empty := ""
+	p := profile{Bio: "hi", Age: 7, Email: &empty, Aliases: []string{"", "x"}}
+	err := derefTag(t).ProcessStructAll(&p)
+	if n := countLeafErrors(err); n != 4 {
+		t.Fatalf("want 4 failures, got %d: %v", n, err)
+	}
+	var pe *ProcessError
+	if !errors.As(err, &pe) || pe.FieldPath != "Bio" {
+		t.Errorf("want the first failure at Bio, got %v", err)
+	}
+}
+
+// A nil pointer is zero, so the modifier skips it even for a directive that
+// would otherwise see nil through NilHandler.
+func TestOmitEmpty_NilPointerBeatsNilHandler(t *testing.T) {
+	type form struct {
+		A *string `val:"present"`
+		B *string `val:"?present"`
+	}
+	err := derefTag(t).ProcessStructAll(&form{})
+	if n := countLeafErrors(err); n != 1 {
+		t.Fatalf("want only A to fail, got %d: %v", n, err)
+	}
+}
+
+func TestCutOmitEmpty(t *testing.T) {
+	tests := []struct {
+		chain string
+		rest  []string
+		ok    bool
+	}{
+		{"omitempty;trim", []string{"trim"}, true},
+		{" ? ;trim", []string{"trim"}, true},
+		{"?trim;lower", []string{"trim", "lower"}, true},
+		{"trim;?", []string{"trim", "?"}, false},
+		{"omitempty", []string{}, true},
+	}
+	for _, tt := range tests {
+		segs, ok := cutOmitEmpty(wholeSpan(tt.chain).chain())
+		rest := make([]string, len(segs))
+		for i, seg := range segs {
+			rest[i] = seg.text
+			if tt.chain[seg.pos:seg.end()] != seg.text {
+				t.Errorf("cutOmitEmpty(%q): segment %q is misplaced at %d", tt.chain, seg.text, seg.pos)
+			}
+		}
+		if ok != tt.ok || strings.Join(rest, ";") != strings.Join(tt.rest, ";") {
+			t.Errorf("cutOmitEmpty(%q) = %q, %v; want %q, %v", tt.chain, rest, ok, tt.rest, tt.ok)
+		}
+	}
+}
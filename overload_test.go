@@ -0,0 +1,103 @@
+package tagex
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sizeDirective is "size, max=N" for any T whose length lenOf reports; each
+// instantiation is a separate overload of the same name.
+type sizeDirective[T any] struct {
+	Max   int `param:"max"`
+	lenOf func(T) int
+}
+
+func (d *sizeDirective[T]) Name() string        { return "size" }
+func (d *sizeDirective[T]) Mode() DirectiveMode { return EvalMode }
+func (d *sizeDirective[T]) Handle(val T) (T, error) {
+	if n := d.lenOf(val); n > d.Max {
+		return val, fmt.Errorf("size %d exceeds %d", n, d.Max)
+	}
+	return val, nil
+}
+
+func sizeTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &sizeDirective[string]{lenOf: func(s string) int { return len(s) }})
+	MustRegisterDirective(tag, &sizeDirective[[]byte]{lenOf: func(b []byte) int { return len(b) }})
+	MustRegisterDirective(tag, &sizeDirective[[]int]{lenOf: func(s []int) int { return len(s) }})
+	return tag
+}
+
+func TestOverload_DispatchByFieldType(t *testing.T) {
+	tag := sizeTag(t)
+
+	type blob struct {
+		Name string   `val:"size, max=3"`
+		Data []byte   `val:"size, max=2"`
+		IDs  []int    `val:"size, max=1"`
+		Tags []string `val:"each(size, max=2)"`
+	}
+	err := ProcessStructAll(&blob{Name: "abcd", Data: []byte("abc"), IDs: []int{1, 2}, Tags: []string{"abc"}}, tag)
+	if n := countLeafErrors(err); n != 4 {
+		t.Fatalf("want 4 errors, got %d: %v", n, err)
+	}
+	if err := ProcessStruct(&blob{Name: "abc", Data: []byte("ab"), IDs: []int{1}}, tag); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestOverload_InterfaceUsesDynamicType(t *testing.T) {
+	tag := sizeTag(t)
+
+	type holder struct {
+		V any `val:"size, max=2"`
+	}
+	if err := tag.ProcessStruct(&holder{V: []int{1, 2}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var he *HandleError
+	if err := tag.ProcessStruct(&holder{V: "abc"}); !errors.As(err, &he) {
+		t.Errorf("expected the string overload to reject, got %v", err)
+	}
+	var tm *TypeMismatchError
+	if err := tag.ProcessStruct(&holder{V: 3.5}); !errors.As(err, &tm) || len(tm.Available) != 3 {
+		t.Errorf("expected *TypeMismatchError listing overloads, got %v", err)
+	}
+}
+
+func TestOverload_NoMatchListsAvailable(t *testing.T) {
+	tag := sizeTag(t)
+
+	type bad struct {
+		N int `val:"size, max=1"`
+	}
+	err := tag.ProcessStruct(&bad{})
+	var tm *TypeMismatchError
+	if !errors.As(err, &tm) {
+		t.Fatalf("expected *TypeMismatchError, got %v", err)
+	}
+	want := []reflect.Type{reflect.TypeFor[string](), reflect.TypeFor[[]byte](), reflect.TypeFor[[]int]()}
+	if tm.Expected != reflect.TypeFor[int]() || !reflect.DeepEqual(tm.Available, want) {
+		t.Errorf("Expected = %v, Available = %v", tm.Expected, tm.Available)
+	}
+	if !strings.Contains(err.Error(), "string, []uint8, []int") {
+		t.Errorf("message %q should list the available types", err)
+	}
+}
+
+func TestOverload_SameTypeRejected(t *testing.T) {
+	tag := sizeTag(t)
+	err := RegisterDirective(tag, &sizeDirective[[]byte]{})
+	var dup *DuplicateDirectiveError
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected *DuplicateDirectiveError, got %v", err)
+	}
+	if dup.Name != "size" || dup.Type != reflect.TypeFor[[]byte]() {
+		t.Errorf("Name = %q, Type = %v", dup.Name, dup.Type)
+	}
+}
@@ -11,11 +11,23 @@ package tagex
 // default=...                      | no            | uses default value
 // required=true + default=...      | yes/no        | error: ParamConflictError
 // required=false + default=...     | yes/no        | error: ParamConflictError
+// flag                             | yes           | bare name sets true; name=v parses v
+// flag                             | no            | skipped; field unchanged
+//
+// A param with pos=N also takes the N'th bare (positional) arg, and a variadic
+// param takes every positional arg no pos=N param claims. Either may still be
+// given by name, but not both ways at once (ParamConflictError).
 //
 // Any chosen value still goes through ParamConverter/DefaultConvert and can fail.
 import (
+	"context"
+	"encoding"
+	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const paramKey = "param"
@@ -24,10 +36,15 @@ type paramSpec struct {
 	name         string
 	required     bool
 	defaultValue *string
+	pos          int // index among the positional args, or -1
+	variadic     bool
+	flag         bool
+	constraints  constraints
 }
 
 func parseParamTag(tagValue string) (paramSpec, error) {
-	name, args, err := splitTagValue(tagValue)
+	seg := wholeSpan(tagValue)
+	name, list, err := parseDirective(seg)
 	if err != nil {
 		return paramSpec{}, err
 	}
@@ -35,7 +52,24 @@ func parseParamTag(tagValue string) (paramSpec, error) {
 	spec := paramSpec{
 		name:     name,
 		required: true,
+		pos:      -1,
 	}
+	// Bare words are switches: variadic is variadic=true, flag is flag=true.
+	args := make(map[string]string, len(list))
+	for _, a := range list {
+		switch {
+		case a.Key != "":
+			args[a.Key] = a.Value
+		case a.Value == "variadic", a.Value == "flag":
+			args[a.Value] = "true"
+		default:
+			return paramSpec{}, &ParamParseError{
+				Pair:     a.Value,
+				Position: span{src: tagValue, text: tagValue[a.Pos:a.End], pos: a.Pos}.position(),
+			}
+		}
+	}
+
 	requiredSet := false
 	if raw, ok := args["required"]; ok {
 		parsed, err := strconv.ParseBool(raw)
@@ -52,93 +86,417 @@ func parseParamTag(tagValue string) (paramSpec, error) {
 		spec.defaultValue = &raw
 		spec.required = false
 	}
+	if raw, ok := args["pos"]; ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return paramSpec{}, &ConversionError{Param: name, Raw: raw, Target: "non-negative int"}
+		}
+		spec.pos = n
+	}
+	for _, opt := range []struct {
+		key string
+		dst *bool
+	}{{"variadic", &spec.variadic}, {"flag", &spec.flag}} {
+		if raw, ok := args[opt.key]; ok {
+			parsed, err := strconv.ParseBool(raw)
+			if err != nil {
+				return paramSpec{}, &ConversionError{Param: name, Raw: raw, Target: "bool"}
+			}
+			*opt.dst = parsed
+		}
+	}
 
+	switch {
+	case spec.flag && (requiredSet || spec.defaultValue != nil):
+		return paramSpec{}, &ParamConflictError{Param: name, Reason: "a flag cannot be required or have a default"}
+	case spec.flag && (spec.pos >= 0 || spec.variadic):
+		return paramSpec{}, &ParamConflictError{Param: name, Reason: "a flag cannot be positional"}
+	case spec.variadic && spec.pos >= 0:
+		return paramSpec{}, &ParamConflictError{Param: name, Reason: "a param cannot be both variadic and at a position"}
+	}
+	if spec.flag {
+		spec.required = false
+	}
+	spec.constraints, err = parseConstraints(name, args)
+	if err != nil {
+		return paramSpec{}, err
+	}
 	return spec, nil
 }
 
-// ProcessParams applies tag args to a struct's param-tagged fields. It returns
-// nil on success, or a parameter-typed error (*MissingParamError,
-// *ConversionError, *ParamConflictError, *UnsupportedParamTypeError) on failure.
+// ProcessParams applies tag args to a struct's param-tagged fields, checks
+// their constraints, and runs data's ValidateParams if it is a ParamValidator.
+// It returns nil on success, or a parameter-typed error (*MissingParamError,
+// *ConversionError, *ParamConflictError, *ParamConstraintError,
+// *UnsupportedParamTypeError) or the ParamValidator's error on failure.
 // It is the parameter layer's public entry point and is independent of tags and
 // directives.
 func ProcessParams(data any, args map[string]string) error {
+	return processArgs(data, namedArgs(args), paramConfig{})
+}
+
+// ProcessParamsContext is ProcessParams opting in to variables: ${name}
+// references in args are resolved from the variables ctx carries (see
+// WithVariables), and $$ is a literal $. ProcessParams takes values as they
+// are, so "$${x}" stays "$${x}".
+func ProcessParamsContext(ctx context.Context, data any, args map[string]string) error {
+	return processArgs(data, namedArgs(args), paramConfig{variables: true, vars: variablesFrom(ctx)})
+}
+
+// ProcessArgs is ProcessParams for args as Parse returns them, so that bare
+// args can fill positional, variadic, and flag params. A bare arg that no
+// param accepts is a *ParamParseError.
+func ProcessArgs(data any, args []Arg) error {
+	return processArgs(data, args, paramConfig{})
+}
+
+// namedArgs returns args as a list, in key order.
+func namedArgs(args map[string]string) []Arg {
+	list := make([]Arg, 0, len(args))
+	for k, v := range args {
+		list = append(list, Arg{Key: k, Value: v})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// declaredParam is a param-tagged field of a directive struct type. It
+// holds nothing of a particular value, so a plan can parse a type's params
+// once and share them between calls.
+type declaredParam struct {
+	spec  paramSpec
+	field reflect.StructField
+}
+
+// paramsOf returns the declared params of data, a pointer to a directive
+// struct (see declaredParams).
+func paramsOf(data any) ([]declaredParam, error) {
 	val, err := pointerStruct(data)
 	if err != nil {
-		return &FieldAccessError{Msg: err.Error()}
+		return nil, &FieldAccessError{Msg: err.Error()}
 	}
+	return declaredParams(val.Type())
+}
 
-	for n := 0; n < val.NumField(); n++ {
-		field := val.Type().Field(n)
-		if tagValue, ok := field.Tag.Lookup(paramKey); ok {
-			spec, err := parseParamTag(tagValue)
-			if err != nil {
-				return err
+// declaredParams returns the param-tagged fields of typ, checking that flags
+// are bools, variadic params are slices, no two params claim one position or
+// the rest of the positional args, and min and max suit their fields.
+func declaredParams(typ reflect.Type) ([]declaredParam, error) {
+	var params []declaredParam
+	positions := make(map[int]string)
+	variadic := ""
+	for n := 0; n < typ.NumField(); n++ {
+		field := typ.Field(n)
+		tagValue, ok := field.Tag.Lookup(paramKey)
+		if !ok {
+			continue
+		}
+		spec, err := parseParamTag(tagValue)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case spec.flag && field.Type.Kind() != reflect.Bool:
+			return nil, &ParamConflictError{Param: spec.name, Reason: "a flag needs a bool field"}
+		case spec.variadic && field.Type.Kind() != reflect.Slice:
+			return nil, &ParamConflictError{Param: spec.name, Reason: "a variadic param needs a slice field"}
+		case spec.variadic && variadic != "":
+			return nil, &ParamConflictError{Param: spec.name, Reason: fmt.Sprintf("%q is already variadic", variadic)}
+		case spec.pos >= 0 && positions[spec.pos] != "":
+			return nil, &ParamConflictError{Param: spec.name, Reason: fmt.Sprintf("position %d is already taken by %q", spec.pos, positions[spec.pos])}
+		}
+		if err := spec.constraints.checkDeclaration(spec.name, field.Type); err != nil {
+			return nil, err
+		}
+		if spec.variadic {
+			variadic = spec.name
+		}
+		if spec.pos >= 0 {
+			positions[spec.pos] = spec.name
+		}
+		params = append(params, declaredParam{spec: spec, field: field})
+	}
+	return params, nil
+}
+
+// paramConfig is what a Tag or a call adds to applying params: see
+// SetStrictParams, RegisterConverter, and SetVariable. The zero value is the
+// Tag-free behaviour.
+type paramConfig struct {
+	strict     bool
+	converters map[reflect.Type]converter
+	// variables is set for values written as tag text, the only ones whose
+	// ${name} and $$ are resolved, against vars.
+	variables bool
+	vars      map[string]string
+}
+
+// resolve returns raw, a value given for the param named param, with its
+// variables resolved if cfg takes variables.
+func (cfg paramConfig) resolve(raw, param string) (string, error) {
+	if !cfg.variables {
+		return raw, nil
+	}
+	return resolveVariables(raw, param, cfg.vars)
+}
+
+// processArgs applies args to data's param-tagged fields (see applyArgs).
+func processArgs(data any, args []Arg, cfg paramConfig) error {
+	params, err := paramsOf(data)
+	if err != nil {
+		return err
+	}
+	return applyArgs(data, params, args, cfg)
+}
+
+// applyArgs applies args to params, the declared params of data. Named args
+// are matched by key (a key given twice keeps its last value); bare args are
+// flags when they name a flag param, and positional otherwise. Given values
+// have their variables resolved if cfg.variables is set. With cfg.strict, a
+// named arg that matches no param is an *UnknownParamError.
+func applyArgs(data any, params []declaredParam, args []Arg, cfg paramConfig) error {
+	val := reflect.ValueOf(data).Elem()
+
+	named := make(map[string]string)
+	bare := make(map[string]bool) // params set by a bare arg
+	var positional []Arg
+	for _, a := range args {
+		switch {
+		case a.Key != "":
+			named[a.Key] = a.Value
+		case isFlag(params, a.Value):
+			bare[a.Value] = true
+		default:
+			positional = append(positional, a)
+		}
+	}
+
+	if cfg.strict {
+		declared := make([]string, len(params))
+		for i, p := range params {
+			declared[i] = p.spec.name
+		}
+		for _, a := range args {
+			if a.Key != "" && !contains(declared, a.Key) {
+				return &UnknownParamError{Param: a.Key, Suggestion: closest(a.Key, declared)}
 			}
+		}
+	}
 
-			raw, ok := args[spec.name]
-			if !ok {
-				if spec.defaultValue != nil {
-					raw = *spec.defaultValue
-				} else if spec.required {
-					return &MissingParamError{Param: spec.name}
-				} else {
-					continue
-				}
+	// Hand out the positional args: each to the param at its position, the
+	// rest to the variadic param.
+	values := make(map[string][]string)
+	for i, a := range positional {
+		target := ""
+		for _, p := range params {
+			if p.spec.pos == i || p.spec.variadic && target == "" {
+				target = p.spec.name
 			}
+			if p.spec.pos == i {
+				break
+			}
+		}
+		if target == "" {
+			pe := &ParamParseError{Pair: a.Value, Position: Position{Offset: a.Pos, Len: a.End - a.Pos}}
+			if cfg.strict {
+				pe.Suggestion = closest(a.Value, flagNames(params))
+			}
+			return pe
+		}
+		raw, err := cfg.resolve(a.Value, target)
+		if err != nil {
+			return err
+		}
+		values[target] = append(values[target], raw)
+		bare[target] = true
+	}
 
-			fieldValue := val.FieldByName(field.Name)
-			// Directive-owned conversion
-			if pc, ok := data.(ParamConverter); ok {
-				if err := pc.ConvertParam(field, fieldValue, raw); err != nil {
-					return err
-				}
-				continue
+	for _, p := range params {
+		value := val.FieldByIndex(p.field.Index)
+		raw, ok := named[p.spec.name]
+		if ok && bare[p.spec.name] {
+			return &ParamConflictError{Param: p.spec.name, Reason: "given both by position and by name"}
+		}
+		switch {
+		case ok:
+			raw, err := cfg.resolve(raw, p.spec.name)
+			if err != nil {
+				return err
 			}
+			values[p.spec.name] = []string{raw}
+		case bare[p.spec.name] && p.spec.flag:
+			values[p.spec.name] = []string{"true"}
+		case bare[p.spec.name]:
+		case p.spec.defaultValue != nil:
+			values[p.spec.name] = []string{*p.spec.defaultValue}
+		case p.spec.required:
+			return &MissingParamError{Param: p.spec.name}
+		default:
+			continue
+		}
 
-			// Default conversion
-			if err := DefaultConvert(fieldValue, raw, spec.name); err != nil {
+		raws := values[p.spec.name]
+		for _, raw := range raws {
+			if err := p.spec.constraints.checkRaw(p.spec.name, raw); err != nil {
 				return err
 			}
 		}
+		if p.spec.variadic {
+			slice := reflect.MakeSlice(p.field.Type, len(raws), len(raws))
+			for i, raw := range raws {
+				if err := convertParam(data, p, slice.Index(i), raw, cfg); err != nil {
+					return err
+				}
+			}
+			value.Set(slice)
+		} else if err := convertParam(data, p, value, raws[0], cfg); err != nil {
+			return err
+		}
+		if err := p.spec.constraints.checkBounds(p.spec.name, value, strings.Join(raws, ",")); err != nil {
+			return err
+		}
+	}
+
+	if pv, ok := data.(ParamValidator); ok {
+		return pv.ValidateParams()
 	}
 	return nil
 }
 
+// flagNames returns the names of the flag params among params.
+func flagNames(params []declaredParam) []string {
+	var names []string
+	for _, p := range params {
+		if p.spec.flag {
+			names = append(names, p.spec.name)
+		}
+	}
+	return names
+}
+
+func isFlag(params []declaredParam, name string) bool {
+	for _, p := range params {
+		if p.spec.flag && p.spec.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// convertParam stores raw in fieldValue, the field of p or an element of it,
+// through data's ParamConverter if it has one, and otherwise DefaultConvert
+// with cfg's converters.
+func convertParam(data any, p declaredParam, fieldValue reflect.Value, raw string, cfg paramConfig) error {
+	// Directive-owned conversion
+	if pc, ok := data.(ParamConverter); ok {
+		return pc.ConvertParam(p.field, fieldValue, raw)
+	}
+	// Tag-registered and default conversion
+	return convertValue(fieldValue, raw, p.spec.name, cfg.converters)
+}
+
 const msg = "unable to convert value %q to %s"
 
-// DefaultConvert parses raw into fieldVal using the built-in conversions for
-// string, int, int64, float64, and bool. param names the parameter for error
+// DefaultConvert parses raw into fieldVal using the built-in conversions, and
+// stores raw as the path of a FieldRef. param names the parameter for error
 // messages. It returns a *ConversionError if raw cannot be parsed, or a
 // *UnsupportedParamTypeError if the field type is not supported.
 //
+// The built-in conversions cover:
+//
+//   - any type whose pointer implements encoding.TextUnmarshaler (time.Time,
+//     net.IP, regexp.Regexp, ...), which takes precedence over its kind;
+//   - time.Duration, parsed by time.ParseDuration, or a bare integer as
+//     nanoseconds;
+//   - string, bool, and every sized int, uint, and float, parsed by strconv;
+//   - []byte, which holds raw as is;
+//   - other slices, from a list of elements: raw split at top-level ','
+//     ("1,2,3", written ids='1,2,3' in a tag);
+//   - maps, from a list of key=value entries ("a=1,b=2");
+//   - pointers to any of these, allocated as needed.
+//
+// List elements and map keys and values are trimmed, may be quoted like tag
+// values to hold ',' or '=', and are converted by DefaultConvert in turn. An
+// empty raw is an empty slice or map. In a tag, where the list itself is
+// quoted, an element's quotes are doubled:
+//
+//	val:"rule, tags='a,''b,c'''"  // Tags == []string{"a", "b,c"}
+//
 // A ParamConverter implementation can call DefaultConvert to handle the
-// primitive fields it does not convert itself.
+// fields it does not convert itself. DefaultConvert doesn't consult a Tag's
+// RegisterConverter converters.
 func DefaultConvert(fieldVal reflect.Value, raw string, param string) error {
+	return convertValue(fieldVal, raw, param, nil)
+}
+
+// convertValue is DefaultConvert with the converters registered on a Tag,
+// which take precedence for their type at any depth: a field, a list element,
+// a map key or value, or a pointer's target.
+func convertValue(fieldVal reflect.Value, raw string, param string, converters map[reflect.Type]converter) error {
+	typ := fieldVal.Type()
+	if conv, ok := converters[typ]; ok {
+		return conv(fieldVal, raw, param)
+	}
+	if typ == fieldRefType {
+		fieldVal.Set(reflect.ValueOf(FieldRef{Path: raw}))
+		return nil
+	}
+	if typ.Kind() == reflect.Ptr && typ.Implements(textUnmarshalerType) {
+		ptr := reflect.New(typ.Elem())
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw)); err != nil {
+			return &ConversionError{Param: param, Raw: raw, Target: typ.String(), Err: err}
+		}
+		fieldVal.Set(ptr)
+		return nil
+	}
+	if reflect.PointerTo(typ).Implements(textUnmarshalerType) {
+		ptr := reflect.New(typ)
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw)); err != nil {
+			return &ConversionError{Param: param, Raw: raw, Target: typ.String(), Err: err}
+		}
+		fieldVal.Set(ptr.Elem())
+		return nil
+	}
+	if typ == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			// A bare integer is nanoseconds, as it was before durations
+			// were parsed as such.
+			n, nerr := strconv.ParseInt(raw, 10, 64)
+			if nerr != nil {
+				return &ConversionError{Param: param, Raw: raw, Target: typ.String()}
+			}
+			d = time.Duration(n)
+		}
+		fieldVal.SetInt(int64(d))
+		return nil
+	}
+
 	switch fieldVal.Kind() {
 	case reflect.String:
 		fieldVal.SetString(raw)
 		return nil
 
-	case reflect.Int:
-		i, err := strconv.Atoi(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, typ.Bits())
 		if err != nil {
-			return &ConversionError{Param: param, Raw: raw, Target: "int"}
+			return &ConversionError{Param: param, Raw: raw, Target: fieldVal.Kind().String()}
 		}
-		fieldVal.SetInt(int64(i))
+		fieldVal.SetInt(i)
 		return nil
 
-	case reflect.Int64:
-		i, err := strconv.ParseInt(raw, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(raw, 10, typ.Bits())
 		if err != nil {
-			return &ConversionError{Param: param, Raw: raw, Target: "int64"}
+			return &ConversionError{Param: param, Raw: raw, Target: fieldVal.Kind().String()}
 		}
-		fieldVal.SetInt(i)
+		fieldVal.SetUint(u)
 		return nil
 
-	case reflect.Float64:
-		f, err := strconv.ParseFloat(raw, 64)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, typ.Bits())
 		if err != nil {
-			return &ConversionError{Param: param, Raw: raw, Target: "float64"}
+			return &ConversionError{Param: param, Raw: raw, Target: fieldVal.Kind().String()}
 		}
 		fieldVal.SetFloat(f)
 		return nil
@@ -150,7 +508,79 @@ func DefaultConvert(fieldVal reflect.Value, raw string, param string) error {
 		}
 		fieldVal.SetBool(b)
 		return nil
+
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			fieldVal.SetBytes([]byte(raw))
+			return nil
+		}
+		elems, err := splitList(raw, param, typ)
+		if err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(typ, len(elems), len(elems))
+		for i, e := range elems {
+			if err := convertValue(slice.Index(i), unquote(e), param, converters); err != nil {
+				return err
+			}
+		}
+		fieldVal.Set(slice)
+		return nil
+
+	case reflect.Map:
+		entries, err := splitList(raw, param, typ)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(typ, len(entries))
+		for _, e := range entries {
+			parts := splitTopN(e, '=', 2)
+			if len(parts) != 2 {
+				return &ConversionError{Param: param, Raw: e, Target: typ.String()}
+			}
+			k := reflect.New(typ.Key()).Elem()
+			if err := convertValue(k, unquote(parts[0]), param, converters); err != nil {
+				return err
+			}
+			v := reflect.New(typ.Elem()).Elem()
+			if err := convertValue(v, unquote(parts[1]), param, converters); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, v)
+		}
+		fieldVal.Set(m)
+		return nil
+
+	case reflect.Ptr:
+		ptr := reflect.New(typ.Elem())
+		if err := convertValue(ptr.Elem(), raw, param, converters); err != nil {
+			return err
+		}
+		fieldVal.Set(ptr)
+		return nil
 	}
 
 	return &UnsupportedParamTypeError{Type: fieldVal.Kind()}
 }
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	durationType        = reflect.TypeFor[time.Duration]()
+)
+
+// splitList splits raw, the value of a param of slice or map type typ, into
+// its trimmed top-level ','-separated elements, still quoted. A blank element
+// is a *ConversionError.
+func splitList(raw, param string, typ reflect.Type) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	parts := splitTopN(raw, ',', -1)
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+		if parts[i] == "" {
+			return nil, &ConversionError{Param: param, Raw: raw, Target: typ.String()}
+		}
+	}
+	return parts, nil
+}
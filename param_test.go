@@ -2,8 +2,11 @@ package tagex
 
 import (
 	"errors"
+	"net"
 	"reflect"
+	"regexp"
 	"testing"
+	"time"
 )
 
 type DummyStruct struct {
@@ -96,13 +99,13 @@ func TestProcessParams_Public_Error(t *testing.T) {
 }
 
 type UnsupportedStruct struct {
-	Numbers []int `param:"numbers"`
+	Numbers complex128 `param:"numbers"`
 }
 
 func TestProcessParams_UnsupportedType(t *testing.T) {
 	us := UnsupportedStruct{}
 	args := map[string]string{
-		"numbers": "1,2,3",
+		"numbers": "1+2i",
 	}
 	err := ProcessParams(&us, args)
 	if err == nil {
@@ -282,3 +285,86 @@ func TestSetVal_InvalidConversion(t *testing.T) {
 		t.Errorf("unexpected error message: %v", err)
 	}
 }
+
+func TestSetVal_Kinds(t *testing.T) {
+	type level uint16
+	tests := []struct {
+		raw  string
+		want any
+	}{
+		{"-8", int8(-8)},
+		{"70000", int32(70000)},
+		{"255", uint8(255)},
+		{"9", level(9)},
+		{"1.5", float32(1.5)},
+		{"1m30s", 90 * time.Second},
+		{"5000", 5 * time.Microsecond},
+		{"2026-01-02T03:04:05Z", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"10.0.0.1", net.ParseIP("10.0.0.1")},
+		{"raw,bytes", []byte("raw,bytes")},
+		{"a, 'b,c' ,''", []string{"a", "b,c", ""}},
+		{"1,2,3", []int{1, 2, 3}},
+		{"", []int{}},
+		{"a=1, 'b=c'=2", map[string]int{"a": 1, "b=c": 2}},
+		{"7", ptr(7)},
+	}
+	for _, tt := range tests {
+		v := reflect.New(reflect.TypeOf(tt.want)).Elem()
+		if err := DefaultConvert(v, tt.raw, "value"); err != nil {
+			t.Errorf("%T from %q: unexpected error: %v", tt.want, tt.raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(v.Interface(), tt.want) {
+			t.Errorf("%T from %q = %#v, want %#v", tt.want, tt.raw, v.Interface(), tt.want)
+		}
+	}
+
+	var re *regexp.Regexp
+	if err := DefaultConvert(reflect.ValueOf(&re).Elem(), `^\d+$`, "value"); err != nil || !re.MatchString("42") {
+		t.Errorf("*regexp.Regexp: got %v, %v", re, err)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestSetVal_KindErrors(t *testing.T) {
+	tests := []struct {
+		raw    string
+		target any
+	}{
+		{"256", uint8(0)},
+		{"-1", uint(0)},
+		{"1e40", float32(0)},
+		{"soon", time.Duration(0)},
+		{"1,x,3", []int(nil)},
+		{"1,,3", []int(nil)},
+		{"a", map[string]int(nil)},
+		{"a=b", map[string]int(nil)},
+		{"(", (*regexp.Regexp)(nil)},
+	}
+	for _, tt := range tests {
+		v := reflect.New(reflect.TypeOf(tt.target)).Elem()
+		var convErr *ConversionError
+		if err := DefaultConvert(v, tt.raw, "value"); !errors.As(err, &convErr) || convErr.Param != "value" {
+			t.Errorf("%T from %q: want a *ConversionError, got %v", tt.target, tt.raw, err)
+		}
+	}
+}
+
+// A list is written quoted in a tag, and its elements may be quoted inside.
+func TestProcessParams_ListInTag(t *testing.T) {
+	type tags struct {
+		Tags []string `param:"tags"`
+	}
+	c, err := Parse("t, tags='a,''b,c'''")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var d tags
+	if err := ProcessArgs(&d, c.Segments[0].Args); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(d.Tags, []string{"a", "b,c"}) {
+		t.Errorf("got %q", d.Tags)
+	}
+}
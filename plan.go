@@ -0,0 +1,625 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// This file compiles a struct type's tags into a plan. Everything a field's tag
+// value resolves to — its ';' segments, the directive each names, and that
+// directive's converted params — depends only on the reflect.Type and on the
+// Tag's registry, so it is worked out once per (Tag, type) and cached on the Tag.
+// Later ProcessStruct calls run the cached plan directly instead of re-parsing.
+//
+// A parse or param failure is compiled into the plan as a stored *ProcessError
+// and returned when its segment is reached, so errors keep the stage and the
+// chain ordering they had when tags were parsed on every call: segments before
+// the broken one still run.
+
+// structPlan is the compiled form of one struct type for one Tag.
+type structPlan struct {
+	// fields holds one chain per struct field, indexed like reflect's
+	// Type.Field(n). It is nil for unexported fields and fields without the
+	// Tag's key.
+	fields []chainPlan
+}
+
+// chainPlan is a field's compiled directive chain, in tag order.
+type chainPlan []step
+
+// step is one compiled element of a chain: a directive segment, a group, a
+// condition, or a macro.
+type step interface {
+	run(ctx context.Context, val reflect.Value, field *FieldInfo) error
+}
+
+// segmentPlan is one compiled ';' segment. Exactly one of directive, err, and
+// byType is set: directive is a private copy of the registered template with
+// its params already applied; err is the failure found while compiling the
+// segment; byType holds the segment compiled for each overload when the
+// overload can only be chosen from an interface value's dynamic type (types
+// lists the typed ones in registration order). refs lists the sibling paths the
+// directive's FieldRef params name, so a failure can report both fields.
+type segmentPlan struct {
+	name      string
+	directive anyDirective
+	err       *ProcessError
+	refs      []string
+	byType    map[reflect.Type]*segmentPlan
+	types     []reflect.Type
+	late      *lateParams
+}
+
+// lateParams is a segment whose args refer to variables: its params are
+// applied each time it runs, with the variables of that call. The directive's
+// declared params, constraints included, are parsed once when it compiles.
+type lateParams struct {
+	template anyDirective
+	params   []declaredParam
+	src      string
+	args     []Arg
+	parent   reflect.Type
+	cfg      paramConfig
+}
+
+// groupPlan is a compiled element group — each(...), keys(...), or
+// values(...) — whose inner chain runs on every element, key, or value of the
+// collection the field holds. err is set when the field's type can't hold
+// what op ranges over.
+type groupPlan struct {
+	op    string
+	chain chainPlan
+	err   *ProcessError
+}
+
+// Group names. each ranges over the elements of a slice or array and the
+// values of a map; keys and values apply only to maps.
+const (
+	groupEach   = "each"
+	groupKeys   = "keys"
+	groupValues = "values"
+)
+
+func isGroup(op string) bool {
+	return op == groupEach || op == groupKeys || op == groupValues
+}
+
+// plan returns t's compiled plan for the struct type typ, compiling and caching
+// it on first use. The caller must hold t.mut (for reading at least), which is
+// also what keeps the cache consistent with the registry: resetPlans runs under
+// the write lock.
+func (t *Tag) plan(typ reflect.Type) *structPlan {
+	if p, ok := t.plans.Load(typ); ok {
+		return p.(*structPlan)
+	}
+	p, _ := t.plans.LoadOrStore(typ, t.compileStruct(typ))
+	return p.(*structPlan)
+}
+
+// resetPlans drops every cached plan. It is called whenever the registry
+// changes, under t.mut's write lock.
+func (t *Tag) resetPlans() {
+	t.plans.Range(func(key, _ any) bool {
+		t.plans.Delete(key)
+		return true
+	})
+}
+
+func (t *Tag) compileStruct(typ reflect.Type) *structPlan {
+	p := &structPlan{fields: make([]chainPlan, typ.NumField())}
+	for n := 0; n < typ.NumField(); n++ {
+		field := typ.Field(n)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		if tagValue, ok := field.Tag.Lookup(t.Key); ok {
+			p.fields[n] = compileChain(t, wholeSpan(tagValue), field.Type, typ)
+		}
+	}
+	return p
+}
+
+// compileChain compiles every ';' segment of tagValue for a value of type typ
+// held by a field of the struct type parent. Either type may be nil: typ when
+// it is only known at run time, parent when there is no enclosing struct to
+// resolve FieldRef params against.
+func compileChain(tag *Tag, tagValue span, typ, parent reflect.Type) chainPlan {
+	segs := tagValue.chain()
+	if rest, ok := cutOmitEmpty(segs); ok {
+		return chainPlan{&omitPlan{chain: compileSegments(tag, rest, typ, parent)}}
+	}
+	return compileSegments(tag, segs, typ, parent)
+}
+
+// compileSegments compiles the split segments of a chain; see compileChain.
+func compileSegments(tag *Tag, segs []span, typ, parent reflect.Type) chainPlan {
+	if len(segs) == 0 {
+		return nil
+	}
+	chain := make(chainPlan, 0, len(segs))
+	for _, seg := range segs {
+		if op, inner, ok := seg.group(); ok {
+			switch {
+			case isGroup(op):
+				chain = append(chain, compileGroup(tag, op, inner, typ, parent))
+				continue
+			case isCondition(op):
+				chain = append(chain, compileCondition(tag, op, inner, typ, parent))
+				continue
+			case isCombinator(op):
+				chain = append(chain, compileCombinator(tag, op, inner, typ, parent))
+				continue
+			}
+		}
+		if name, args, err := tag.segmentArgs(seg); err == nil {
+			if expansion, ok := tag.macros[name]; ok {
+				chain = append(chain, compileMacro(tag, name, expansion, seg, args, typ, parent))
+				continue
+			}
+		}
+		chain = append(chain, compileSegment(tag, seg, typ, parent))
+	}
+	return chain
+}
+
+// compileGroup compiles the chain inner for whatever op ranges over in a value
+// of type typ. An interface (or unknown) typ defers the check to run time.
+func compileGroup(tag *Tag, op string, inner span, typ, parent reflect.Type) *groupPlan {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	var elem reflect.Type
+	if typ != nil && typ.Kind() != reflect.Interface {
+		if !groupFits(op, typ.Kind()) {
+			return &groupPlan{op: op, err: &ProcessError{
+				Stage:     StageDirective,
+				Directive: op,
+				Cause:     &GroupTypeError{Group: op, Type: typ},
+			}}
+		}
+		elem = typ.Elem()
+		if op == groupKeys {
+			elem = typ.Key()
+		}
+	}
+	return &groupPlan{op: op, chain: compileChain(tag, inner, elem, parent)}
+}
+
+// groupFits reports whether the group op can range over a value of kind k.
+func groupFits(op string, k reflect.Kind) bool {
+	switch k {
+	case reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		return op == groupEach
+	}
+	return false
+}
+
+// compileSegment parses a single directive segment ("name, k=v, ...") for a
+// value of type typ, selects the registered overload for that type, and
+// applies its args to a copy, resolving any FieldRef params against parent.
+func compileSegment(tag *Tag, seg span, typ, parent reflect.Type) *segmentPlan {
+	directiveName, args, err := tag.segmentArgs(seg)
+	if err != nil {
+		stage, param := StageDirective, ""
+		var paramErr *ParamParseError
+		var dupErr *DuplicateParamError
+		switch {
+		case errors.As(err, &paramErr):
+			stage = StageParam
+		case errors.As(err, &dupErr):
+			stage, param = StageParam, dupErr.Param
+		}
+		return &segmentPlan{name: directiveName, err: &ProcessError{
+			Stage:     stage,
+			Directive: directiveName,
+			Param:     param,
+			Cause:     err,
+		}}
+	}
+	overloads, ok := tag.lookup(directiveName)
+	if !ok {
+		return &segmentPlan{name: directiveName, err: &ProcessError{
+			Stage:     StageDirective,
+			Directive: directiveName,
+			Cause:     &UnknownDirectiveError{Name: directiveName},
+		}}
+	}
+	template, err := selectOverload(tag, overloads, typ)
+	if err != nil {
+		return &segmentPlan{name: directiveName, err: &ProcessError{
+			Stage:     StageDirective,
+			Directive: directiveName,
+			Cause:     err,
+		}}
+	}
+	if template == nil {
+		// An interface value: compile every overload and pick one by the
+		// dynamic type when the segment runs.
+		// A ValueDirective is stored under the nil type.
+		s := &segmentPlan{name: directiveName, byType: make(map[reflect.Type]*segmentPlan, len(overloads))}
+		for _, o := range overloads {
+			s.byType[o.valueType()] = compileDirective(tag, o, directiveName, seg.src, args, parent)
+		}
+		s.types = overloadTypes(overloads)
+		return s
+	}
+	template, mismatch := fitDirective(tag, template, typ)
+	if mismatch != nil {
+		return &segmentPlan{name: directiveName, err: &ProcessError{
+			Stage:     StageDirective,
+			Directive: directiveName,
+			Cause:     mismatch,
+		}}
+	}
+	return compileDirective(tag, template, directiveName, seg.src, args, parent)
+}
+
+// selectOverload picks the overload of a directive for a value of type typ:
+// the only one, the one whose T is typ, the one whose T is an interface typ
+// implements, the same again for what a pointer or wrapper typ holds, or else
+// the name's ValueDirective. It returns nil and no error when the choice must wait
+// for the dynamic type of an interface value (or for a typ unknown until run
+// time), and a *TypeMismatchError when no overload fits.
+func selectOverload(tag *Tag, overloads []anyDirective, typ reflect.Type) (anyDirective, error) {
+	if len(overloads) == 1 {
+		// A lone directive keeps reporting a mismatch from Handle, as before
+		// overloading.
+		return overloads[0], nil
+	}
+	if typ == nil {
+		return nil, nil
+	}
+	if typ.Kind() == reflect.Interface {
+		for _, o := range overloads {
+			if o.valueType() == typ {
+				return o, nil
+			}
+		}
+		return nil, nil
+	}
+	types := overloadTypes(overloads)
+	for t := typ; t != nil; t = tag.peel(t) {
+		match, err := matchOverload(types, t)
+		if err != nil {
+			return nil, err
+		}
+		if match != nil {
+			for _, o := range overloads {
+				if o.valueType() == match {
+					return o, nil
+				}
+			}
+		}
+	}
+	for _, o := range overloads {
+		if o.valueType() == nil {
+			return o, nil
+		}
+	}
+	return nil, &TypeMismatchError{Expected: typ, Available: types}
+}
+
+// peel returns the type typ holds — a pointer's element, a wrapper's value —
+// or nil when it holds none.
+func (t *Tag) peel(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	if _, wrapped, ok := t.unwrapperFor(typ); ok {
+		return wrapped
+	}
+	return nil
+}
+
+// matchOverload returns the type among types that is typ itself or, failing
+// that, an interface typ implements. It is nil when there is none.
+func matchOverload(types []reflect.Type, typ reflect.Type) (reflect.Type, error) {
+	for _, t := range types {
+		if t == typ {
+			return t, nil
+		}
+	}
+	return implementer(types, typ)
+}
+
+// implementer returns the interface type among types that typ implements
+// (directly or through its pointer), or nil if there is none. More than one is
+// ambiguous and reported as a *TypeMismatchError.
+func implementer(types []reflect.Type, typ reflect.Type) (reflect.Type, error) {
+	var found []reflect.Type
+	for _, t := range types {
+		if implements(typ, t) || viaPointer(t, typ) {
+			found = append(found, t)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		return found[0], nil
+	}
+	return nil, &TypeMismatchError{
+		Expected:  typ,
+		Available: found,
+		Reason:    "ambiguous: it implements more than one overload's interface",
+	}
+}
+
+// overloadTypes lists the T of each typed overload, in registration order.
+func overloadTypes(overloads []anyDirective) []reflect.Type {
+	var types []reflect.Type
+	for _, o := range overloads {
+		if t := o.valueType(); t != nil {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// compileDirective applies args to a copy of the registered directive template
+// and resolves its FieldRef params against parent. src is the text args were
+// parsed from, for locating an arg no param accepts. Args that refer to
+// variables are left to apply when the segment runs.
+func compileDirective(tag *Tag, template anyDirective, directiveName, src string, args []Arg, parent reflect.Type) *segmentPlan {
+	params, err := paramsOf(template.Unwrap())
+	if err != nil {
+		return paramErrorPlan(directiveName, src, err)
+	}
+	if usesVariables(args) {
+		return &segmentPlan{name: directiveName, late: &lateParams{
+			template: template,
+			params:   params,
+			src:      src,
+			args:     args,
+			parent:   parent,
+			cfg:      tag.paramConfig(),
+		}}
+	}
+	return applyParams(template, params, directiveName, src, args, parent, tag.paramConfig())
+}
+
+// applyParams is compileDirective once the variables are known, in cfg, and
+// the template's declared params parsed.
+func applyParams(template anyDirective, params []declaredParam, directiveName, src string, args []Arg, parent reflect.Type, cfg paramConfig) *segmentPlan {
+	directive := template.clone() // the plan's own copy; never mutate the shared template
+	if err := applyArgs(directive.Unwrap(), params, args, cfg); err != nil {
+		return paramErrorPlan(directiveName, src, err)
+	}
+	refs, param, err := resolveFieldRefs(directive.Unwrap(), parent)
+	if err != nil {
+		return &segmentPlan{name: directiveName, err: &ProcessError{
+			Stage:     StageParam,
+			Directive: directiveName,
+			Param:     param,
+			Cause:     err,
+		}}
+	}
+	return &segmentPlan{name: directiveName, directive: directive, refs: refs}
+}
+
+// paramErrorPlan is the plan of a segment whose params failed to apply with
+// err, naming the param at fault where err has one.
+func paramErrorPlan(directiveName, src string, err error) *segmentPlan {
+	param := ""
+	var missingErr *MissingParamError
+	if errors.As(err, &missingErr) {
+		param = missingErr.Param
+	}
+	var unknownErr *UnknownParamError
+	if errors.As(err, &unknownErr) {
+		param = unknownErr.Param
+	}
+	var conflictErr *ParamConflictError
+	if errors.As(err, &conflictErr) {
+		param = conflictErr.Param
+	}
+	var constraintErr *ParamConstraintError
+	if errors.As(err, &constraintErr) {
+		param = constraintErr.Param
+	}
+	var varErr *UnknownVariableError
+	if errors.As(err, &varErr) {
+		param = varErr.Param
+	}
+	var convErr *ConversionError
+	if errors.As(err, &convErr) && param == "" {
+		param = convErr.Param
+	}
+	var parseErr *ParamParseError
+	if errors.As(err, &parseErr) && parseErr.Source == "" {
+		// A stray positional arg: applyArgs knows only its offsets.
+		at := parseErr.Offset
+		parseErr.Position = span{src: src, text: src[at : at+parseErr.Len], pos: at}.position()
+	}
+	return &segmentPlan{name: directiveName, err: &ProcessError{
+		Stage:     StageParam,
+		Directive: directiveName,
+		Param:     param,
+		Cause:     err,
+	}}
+}
+
+// run applies the chain to fieldValue left-to-right, stopping at the first
+// failing segment. Each MutMode segment's written-back value is what the next
+// segment reads, so order is significant ("trim;length, min=3" differs from
+// "length, min=3;trim"). Under ProcessStructAll a MutMode segment that already
+// ran has still mutated the field even when a later segment fails.
+func (c chainPlan) run(ctx context.Context, fieldValue reflect.Value, field *FieldInfo) error {
+	for _, s := range c {
+		if err := s.run(ctx, fieldValue, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *segmentPlan) run(ctx context.Context, fieldValue reflect.Value, field *FieldInfo) error {
+	if s.err != nil {
+		// Return a copy: the caller fills in FieldPath, and the stored error is
+		// shared by every call that runs this plan.
+		e := *s.err
+		return &e
+	}
+	if s.byType != nil {
+		return s.dispatch(ctx, fieldValue, field)
+	}
+	if s.late != nil {
+		l := s.late
+		cfg := l.cfg
+		cfg.vars = mergeVariables(cfg.vars, variablesFrom(ctx))
+		return applyParams(l.template, l.params, s.name, l.src, l.args, l.parent, cfg).run(ctx, fieldValue, field)
+	}
+	// The plan's directive already holds its params; a per-call copy keeps
+	// concurrent calls from sharing any state Handle writes.
+	f, reads := field, []string(nil)
+	if len(s.refs) > 0 {
+		c := *field
+		c.reads = &reads
+		f = &c
+	}
+	if err := s.directive.clone().handle(ctx, fieldValue, f); err != nil {
+		// Only the directive's own failure is a cross-field one; a type
+		// mismatch or failed write is the framework's.
+		if _, ok := err.(*HandleError); ok && len(s.refs) > 0 {
+			err = crossFieldError(field, s.refs, reads, err)
+		}
+		return &ProcessError{
+			Stage:     StageDirective,
+			Directive: s.name,
+			Cause:     err,
+		}
+	}
+	return nil
+}
+
+// crossFieldError wraps err, the Handle error of a directive with the FieldRef
+// paths refs that read the paths reads before failing.
+func crossFieldError(field *FieldInfo, refs, reads []string, err error) *CrossFieldError {
+	paths := reads
+	if len(paths) == 0 {
+		paths = refs
+	}
+	e := &CrossFieldError{FieldPath: field.Path, Err: err}
+	for _, p := range paths {
+		e.OtherPaths = append(e.OtherPaths, joinPath(field.parentPath, p))
+	}
+	if len(reads) > 0 {
+		e.OtherPath = e.OtherPaths[len(e.OtherPaths)-1]
+	} else {
+		e.OtherPath = e.OtherPaths[0]
+	}
+	return e
+}
+
+// dispatch runs the overload whose T is the dynamic type of the interface
+// value fieldValue, chosen as selectOverload does for a static type.
+func (s *segmentPlan) dispatch(ctx context.Context, fieldValue reflect.Value, field *FieldInfo) error {
+	dyn := fieldValue
+	for dyn.Kind() == reflect.Interface && !dyn.IsNil() {
+		dyn = dyn.Elem()
+	}
+	if o, ok := s.byType[dyn.Type()]; ok {
+		return o.run(ctx, fieldValue, field)
+	}
+	iface, err := implementer(s.types, dyn.Type())
+	if err != nil {
+		return &ProcessError{Stage: StageDirective, Directive: s.name, Cause: err}
+	}
+	if iface != nil {
+		return s.byType[iface].run(ctx, fieldValue, field)
+	}
+	if o, ok := s.byType[nil]; ok {
+		return o.run(ctx, fieldValue, field)
+	}
+	return &ProcessError{
+		Stage:     StageDirective,
+		Directive: s.name,
+		Cause:     &TypeMismatchError{Expected: dyn.Type(), Available: s.types},
+	}
+}
+
+// run applies g's chain to each element, key, or value of val, stopping at the
+// first failure or, checked before each element as processValue does, once
+// ctx is done. The chain sees the element's path (Tags[2], Headers[key]) in
+// its FieldInfo, and a failure is reported at that path. MutMode results are
+// written back: slice and array elements in place, map values and keys by
+// storing them back into the map.
+func (g *groupPlan) run(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	if g.err != nil {
+		e := *g.err
+		return &e
+	}
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if !groupFits(g.op, val.Kind()) {
+		return &ProcessError{
+			Stage:     StageDirective,
+			Directive: g.op,
+			Cause:     &GroupTypeError{Group: g.op, Type: val.Type()},
+		}
+	}
+
+	elemInfo := *field
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			elemInfo.Path = fmt.Sprintf("%s[%d]", field.Path, i)
+			if err := ctx.Err(); err != nil {
+				return contextError(elemInfo.Path, err)
+			}
+			if err := g.chain.run(ctx, val.Index(i), &elemInfo); err != nil {
+				return elemError(elemInfo.Path, err)
+			}
+		}
+	case reflect.Map:
+		for _, key := range val.MapKeys() {
+			elemInfo.Path = fmt.Sprintf("%s[%v]", field.Path, key.Interface())
+			if err := ctx.Err(); err != nil {
+				return contextError(elemInfo.Path, err)
+			}
+			if g.op == groupKeys {
+				// A rewritten key moves its entry; if the new key is already
+				// present, that entry is replaced.
+				k := reflect.New(key.Type()).Elem()
+				k.Set(key)
+				if err := g.chain.run(ctx, k, &elemInfo); err != nil {
+					return elemError(elemInfo.Path, err)
+				}
+				if k.Interface() != key.Interface() {
+					elem := val.MapIndex(key)
+					val.SetMapIndex(key, reflect.Value{})
+					val.SetMapIndex(k, elem)
+				}
+				continue
+			}
+			// Map values are not addressable; run on a copy and store it back,
+			// as processValue does.
+			elem := val.MapIndex(key)
+			c := reflect.New(elem.Type()).Elem()
+			c.Set(elem)
+			if err := g.chain.run(ctx, c, &elemInfo); err != nil {
+				return elemError(elemInfo.Path, err)
+			}
+			val.SetMapIndex(key, c)
+		}
+	}
+	return nil
+}
+
+// elemError locates a failure inside a group at the element's path, unless a
+// nested group already set a deeper one.
+func elemError(path string, err error) error {
+	var pe *ProcessError
+	if errors.As(err, &pe) && pe.FieldPath == "" {
+		pe.FieldPath = path
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package tagex
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// The first ProcessStruct compiles the type's plan; later calls reuse it.
+func TestPlan_CachedPerType(t *testing.T) {
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &RangeDirective{})
+
+	type form struct {
+		N int `val:"range, min=0, max=10"`
+	}
+	if err := tag.ProcessStruct(&form{N: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	typ := reflect.TypeOf(form{})
+	first, ok := tag.plans.Load(typ)
+	if !ok {
+		t.Fatal("expected a cached plan after ProcessStruct")
+	}
+	if err := tag.ProcessStruct(&form{N: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again, _ := tag.plans.Load(typ); again != first {
+		t.Error("expected the second call to reuse the cached plan")
+	}
+}
+
+// A plan that resolved a name as unknown must not outlive a registration that
+// makes the name known.
+func TestPlan_InvalidatedOnRegister(t *testing.T) {
+	tag := NewTag(valTagKey)
+
+	type form struct {
+		N int `val:"range, min=0, max=10"`
+	}
+	err := tag.ProcessStruct(&form{N: 1})
+	var unknown *UnknownDirectiveError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("expected UnknownDirectiveError before registration, got %v", err)
+	}
+
+	MustRegisterDirective(tag, &RangeDirective{})
+	if err := tag.ProcessStruct(&form{N: 1}); err != nil {
+		t.Fatalf("expected success after registration, got %v", err)
+	}
+}
+
+// Compile-time param errors keep their stage and param, and each call gets its
+// own copy: filling in one error's FieldPath must not leak into the plan.
+func TestPlan_StoredErrorsKeepStageAndAreCopied(t *testing.T) {
+	tag := NewTag(valTagKey)
+	MustRegisterDirective(tag, &RangeDirective{})
+
+	type inner struct {
+		N int `val:"range, min=bad, max=10"`
+	}
+	type outer struct {
+		A inner
+		B inner
+	}
+	err := ProcessStructAll(&outer{}, tag)
+	if n := countLeafErrors(err); n != 2 {
+		t.Fatalf("want 2 errors, got %d: %v", n, err)
+	}
+	paths := make([]string, 0, 2)
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var pe *ProcessError
+		if !errors.As(e, &pe) {
+			t.Fatalf("expected *ProcessError, got %v", e)
+		}
+		if pe.Stage != StageParam || pe.Param != "min" {
+			t.Errorf("got stage %q param %q, want %q %q", pe.Stage, pe.Param, StageParam, "min")
+		}
+		paths = append(paths, pe.FieldPath)
+	}
+	if want := []string{"A.N", "B.N"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("field paths = %q, want %q", paths, want)
+	}
+}
+
+// Segments before a broken one still run, exactly as when tags were parsed on
+// every call.
+func TestPlan_ChainRunsUpToStoredError(t *testing.T) {
+	tag := chainTag(t)
+
+	type form struct {
+		Name string `val:"trim;length, min=x"`
+	}
+	f := &form{Name: "  ab  "}
+	err := tag.ProcessStruct(f)
+	var pe *ProcessError
+	if !errors.As(err, &pe) || pe.Stage != StageParam {
+		t.Fatalf("expected StageParam error, got %v", err)
+	}
+	if f.Name != "ab" {
+		t.Errorf("expected trim to have run before the failing segment, got %q", f.Name)
+	}
+}
@@ -0,0 +1,86 @@
+package tagex
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPosition_Excerpt(t *testing.T) {
+	type form struct {
+		S string `val:"trim;length, min=,max=3"`
+	}
+	err := chainTag(t).ProcessStruct(&form{})
+
+	var pe *ParamParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("want a *ParamParseError, got %v", err)
+	}
+	if pe.Source != "trim;length, min=,max=3" || pe.Segment != 1 || pe.Offset != 13 || pe.Len != 4 {
+		t.Errorf("Position = %+v", pe.Position)
+	}
+	want := "trim;length, min=,max=3\n" +
+		"             ^^^^"
+	if got := pe.Excerpt(); got != want {
+		t.Errorf("Excerpt() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// Positions point into the whole tag value from any depth, and count segments
+// as Parse does.
+func TestPosition_Nested(t *testing.T) {
+	tests := []struct {
+		src     string
+		segment int
+		offset  int
+		target  any
+	}{
+		{"?trim; each(lower; length, max=)", 1, 27, new(*ParamParseError)},
+		{"trim;any(lower; , max=1)", 1, 16, new(*DirectiveParseError)},
+		{"omitempty;when(A: trim, x=)", 0, 24, new(*ParamParseError)},
+		{"trim; each(lower;length", 1, 6, new(*DirectiveParseError)},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		if !errors.As(err, tt.target) {
+			t.Errorf("Parse(%q) = %v, want %T", tt.src, err, tt.target)
+			continue
+		}
+		var pos Position
+		switch e := err.(type) {
+		case *ParamParseError:
+			pos = e.Position
+		case *DirectiveParseError:
+			pos = e.Position
+		}
+		if pos.Source != tt.src || pos.Segment != tt.segment || pos.Offset != tt.offset {
+			t.Errorf("Parse(%q): Position = %+v, want segment %d offset %d", tt.src, pos, tt.segment, tt.offset)
+		}
+	}
+}
+
+// An error in a macro's expansion points into the expansion.
+func TestPosition_Macro(t *testing.T) {
+	tag := chainTag(t)
+	tag.MustRegisterMacro("short", "trim;length, min=${min}, max")
+	type form struct {
+		S string `val:"short, min=1"`
+	}
+	var pe *ParamParseError
+	if err := tag.ProcessStruct(&form{}); !errors.As(err, &pe) {
+		t.Fatalf("want a *ParamParseError, got %v", err)
+	}
+	if pe.Source != "trim;length, min=1, max" || pe.Offset != 20 {
+		t.Errorf("Position = %+v", pe.Position)
+	}
+}
+
+func TestPosition_Zero(t *testing.T) {
+	_, _, err := kv("nope")
+	var pe *ParamParseError
+	if !errors.As(err, &pe) || pe.Excerpt() != "" {
+		t.Fatalf("want a *ParamParseError without a position, got %v", err)
+	}
+	if got, want := pe.Error(), `malformed key value pair "nope", expected format is "key=value"`; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package tagex
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// oneofDirective accepts a value listed in Values, given positionally.
+type oneofDirective struct {
+	Values []string `param:"values, variadic"`
+}
+
+func (d *oneofDirective) Name() string        { return "oneof" }
+func (d *oneofDirective) Mode() DirectiveMode { return EvalMode }
+func (d *oneofDirective) Handle(val string) (string, error) {
+	for _, v := range d.Values {
+		if v == val {
+			return val, nil
+		}
+	}
+	return val, errors.New("not one of the listed values")
+}
+
+// padDirective pads a value to Width, on the left when Left is set.
+type padDirective struct {
+	Width int  `param:"width, pos=0"`
+	Left  bool `param:"left, flag"`
+}
+
+func (d *padDirective) Name() string        { return "pad" }
+func (d *padDirective) Mode() DirectiveMode { return MutMode }
+func (d *padDirective) Handle(val string) (string, error) {
+	for len(val) < d.Width {
+		if d.Left {
+			val = " " + val
+		} else {
+			val += " "
+		}
+	}
+	return val, nil
+}
+
+func positionalTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := chainTag(t)
+	MustRegisterDirective(tag, &oneofDirective{})
+	MustRegisterDirective(tag, &padDirective{})
+	return tag
+}
+
+func TestPositionalArgs(t *testing.T) {
+	type form struct {
+		Colour string `val:"oneof, red, 'dark,green', blue"`
+		Code   string `val:"pad, 4, left"`
+		Name   string `val:"pad, width=4, left=false"`
+	}
+	f := form{Colour: "dark,green", Code: "7", Name: "ab"}
+	if err := positionalTag(t).ProcessStruct(&f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Code != "   7" || f.Name != "ab  " {
+		t.Errorf("got Code %q, Name %q", f.Code, f.Name)
+	}
+
+	bad := form{Colour: "green"}
+	var he *HandleError
+	if err := positionalTag(t).ProcessStruct(&bad); !errors.As(err, &he) {
+		t.Errorf("want a *HandleError for green, got %v", err)
+	}
+}
+
+func TestPositionalArgs_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		param  string
+		target any
+	}{
+		{"both ways", &struct {
+			S string `val:"pad, 4, width=5"`
+		}{}, "width", new(*ParamConflictError)},
+		{"no position left", &struct {
+			S string `val:"pad, 4, 5"`
+		}{}, "", new(*ParamParseError)},
+		{"not positional", &struct {
+			S string `val:"length, 1, max=3"`
+		}{}, "", new(*ParamParseError)},
+	}
+	for _, tt := range tests {
+		err := positionalTag(t).ProcessStruct(tt.value)
+		var pe *ProcessError
+		if !errors.As(err, &pe) || pe.Stage != StageParam || pe.Param != tt.param {
+			t.Errorf("%s: want a StageParam failure of param %q, got %v", tt.name, tt.param, err)
+		}
+		if !errors.As(err, tt.target) {
+			t.Errorf("%s: want %T, got %v", tt.name, tt.target, err)
+		}
+	}
+
+	// A stray positional arg points into the tag value.
+	type form struct {
+		S string `val:"trim;pad, 4, 5"`
+	}
+	var pe *ParamParseError
+	if err := positionalTag(t).ProcessStruct(&form{}); !errors.As(err, &pe) {
+		t.Fatalf("want a *ParamParseError, got %v", err)
+	}
+	if pe.Source != "trim;pad, 4, 5" || pe.Segment != 1 || pe.Offset != 13 || pe.Len != 1 {
+		t.Errorf("Position = %+v", pe.Position)
+	}
+}
+
+func TestParamTag_Declarations(t *testing.T) {
+	tests := []struct {
+		name string
+		data any
+	}{
+		{"flag with default", &struct {
+			On bool `param:"on, flag, default=true"`
+		}{}},
+		{"positional flag", &struct {
+			On bool `param:"on, flag, pos=0"`
+		}{}},
+		{"variadic at a position", &struct {
+			Vs []string `param:"vs, variadic, pos=1"`
+		}{}},
+		{"flag not bool", &struct {
+			On string `param:"on, flag"`
+		}{}},
+		{"variadic not slice", &struct {
+			Vs string `param:"vs, variadic"`
+		}{}},
+		{"two variadics", &struct {
+			A []string `param:"a, variadic"`
+			B []string `param:"b, variadic"`
+		}{}},
+		{"shared position", &struct {
+			A string `param:"a, pos=0"`
+			B string `param:"b, pos=0"`
+		}{}},
+	}
+	for _, tt := range tests {
+		var ce *ParamConflictError
+		if err := ProcessArgs(tt.data, nil); !errors.As(err, &ce) {
+			t.Errorf("%s: want a *ParamConflictError, got %v", tt.name, err)
+		}
+	}
+
+	var conv *ConversionError
+	if err := ProcessArgs(&struct {
+		A string `param:"a, pos=first"`
+	}{}, nil); !errors.As(err, &conv) {
+		t.Errorf("want a *ConversionError for pos=first, got %v", err)
+	}
+	var pe *ParamParseError
+	if err := ProcessArgs(&struct {
+		A string `param:"a, optional"`
+	}{}, nil); !errors.As(err, &pe) || pe.Pair != "optional" {
+		t.Errorf("want a *ParamParseError for optional, got %v", err)
+	}
+}
+
+func TestProcessArgs(t *testing.T) {
+	var d struct {
+		Op   string `param:"op, pos=0"`
+		Nums []int  `param:"nums, variadic"`
+		Neg  bool   `param:"neg, flag"`
+	}
+	c, err := Parse("calc, sum, 1, neg, 2, 3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ProcessArgs(&d, c.Segments[0].Args); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Op != "sum" || !reflect.DeepEqual(d.Nums, []int{1, 2, 3}) || !d.Neg {
+		t.Errorf("got %+v", d)
+	}
+
+	// A variadic param given by name holds one element.
+	if err := ProcessParams(&d, map[string]string{"op": "max", "nums": "9"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(d.Nums, []int{9}) {
+		t.Errorf("got Nums %v", d.Nums)
+	}
+}
+
+// Macros take key=value args only.
+func TestPositionalArgs_Macro(t *testing.T) {
+	tag := positionalTag(t)
+	tag.MustRegisterMacro("short", "length, min=0, max=${max}")
+	type form struct {
+		S string `val:"short, 3"`
+	}
+	var pe *ParamParseError
+	if err := tag.ProcessStruct(&form{}); !errors.As(err, &pe) || pe.Offset != 7 {
+		t.Fatalf("want a *ParamParseError at offset 7, got %v", err)
+	}
+}
@@ -1,16 +1,26 @@
 package tagex
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+)
 
 // This file is the tag-value parser: it turns a raw struct-tag string such as
 //
 //	"trim;length, min=3, max=20"
 //	"regex, pattern='\\d{1,3}'"
+//	"each(trim;lower)"
+//	"any(email; all(trim;phone))"
 //
 // into directive segments, a directive name, and an args map. All splitting goes
 // through one quote-aware scanner (splitTopN) so that the separators ';', ',',
 // and '=' can appear literally inside a value when it is wrapped in single
 // quotes. A literal single quote inside a quoted value is written doubled ('').
+// The scanner also treats the parentheses of a group, condition, or
+// combinator that starts a segment as one unit, so each(trim;lower) or
+// any(email; phone) keeps its inner chain together as a single segment,
+// however deeply it nests. Any other '(' is ordinary text: "contains, sub=("
+// and "note, text=a:any(b" are directives with a param.
 //
 // Single quotes are used because the struct-tag value is itself delimited by
 // double quotes (`val:"..."`), and Go raw-string literals by backticks; the
@@ -20,19 +30,75 @@ import "strings"
 const quote = '\''
 
 // splitTopN splits s on sep, ignoring any sep that falls inside a single-quoted
-// span. It mirrors strings.SplitN: n < 0 splits on every top-level sep, while
-// n > 0 caps the result at n fields (the final field keeps the unsplit
-// remainder, including further seps). A doubled quote (”) inside a quoted span
-// is an escaped quote and does not end the span. splitTopN never copies: each
-// field is a sub-slice of s, with quote characters left intact for unquote.
+// span or inside the parentheses of a group (see scanTop). It mirrors
+// strings.SplitN: n < 0 splits on every top-level sep, while n > 0 caps the
+// result at n fields (the final field keeps the unsplit remainder, including
+// further seps). A doubled quote (”) inside a quoted span is an escaped quote
+// and does not end the span. splitTopN never copies: each field is a sub-slice
+// of s, with quote characters left intact for unquote.
 func splitTopN(s string, sep byte, n int) []string {
+	return splitIn(s, sep, n, chainFrame())
+}
+
+// splitIn is splitTopN for s scanned as the inside of top (see scan).
+func splitIn(s string, sep byte, n int, top frame) []string {
 	if n == 0 {
 		return nil
 	}
 	var out []string
 	start := 0
+	scan(s, top, func(i, depth int) {
+		if s[i] == sep && depth == 0 && (n < 0 || len(out) < n-1) {
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	})
+	return append(out, s[start:])
+}
+
+// frame is what the scanner knows about the text it is in: a chain (at the top
+// level, or inside a group or combinator), a when/unless condition up to its
+// ':', or a condition's "in (...)" value list.
+type frame struct {
+	kind     frameKind
+	segStart int  // offset where the chain's current segment begins
+	first    bool // the current segment is the chain's first
+}
+
+type frameKind int
+
+const (
+	chainKind frameKind = iota
+	condKind
+	listKind
+)
+
+// chainFrame is the frame of a chain starting at offset 0.
+func chainFrame() frame {
+	return frame{kind: chainKind, first: true}
+}
+
+// scanTop calls visit with the offset and group depth of each byte of the
+// chain s that is outside single quotes and isn't a group's own parenthesis
+// (see scan). It returns the offsets of the group '('s left unclosed,
+// outermost first.
+func scanTop(s string, visit func(i, depth int)) (unclosed []int) {
+	return scan(s, chainFrame(), visit)
+}
+
+// scan is scanTop for s scanned as the inside of top. A '(' opens a group only
+// where one can start: after a group, condition, or combinator name that
+// begins a segment of a chain ("each(", "trim; any(", "?each(", "when(A:
+// not("), or after the in of a when/unless condition ("Country in ("). Any
+// other '(', as in "note, text=any(" or "note, text=appears in (x", is
+// visited like a letter. A ')' closes the innermost open group or, with none
+// open, is visited too.
+func scan(s string, top frame, visit func(i, depth int)) (unclosed []int) {
+	var open []int
+	frames := []frame{top}
 	inQuote := false
 	for i := 0; i < len(s); i++ {
+		f := &frames[len(frames)-1]
 		switch c := s[i]; {
 		case c == quote:
 			if inQuote && i+1 < len(s) && s[i+1] == quote {
@@ -40,12 +106,104 @@ func splitTopN(s string, sep byte, n int) []string {
 				continue
 			}
 			inQuote = !inQuote
-		case c == sep && !inQuote && (n < 0 || len(out) < n-1):
-			out = append(out, s[start:i])
-			start = i + 1
+		case inQuote:
+			continue
+		case c == '(':
+			if inner, ok := opensGroup(s, i, *f); ok {
+				open = append(open, i)
+				frames = append(frames, inner)
+				continue
+			}
+		case c == ')' && len(open) > 0:
+			open = open[:len(open)-1]
+			frames = frames[:len(frames)-1]
+			continue
+		case c == ';' && f.kind == chainKind:
+			f.segStart, f.first = i+1, false
+		case c == ':' && f.kind == condKind:
+			*f = frame{kind: chainKind, segStart: i + 1, first: true}
 		}
+		visit(i, len(open))
 	}
-	return append(out, s[start:])
+	return open
+}
+
+// opensGroup reports whether the '(' at s[i], in the frame f, opens a group,
+// and if so the frame of its inside.
+func opensGroup(s string, i int, f frame) (frame, bool) {
+	start, word := wordBefore(s, i)
+	switch {
+	case f.kind == chainKind && (isGroup(word) || isCondition(word) || isCombinator(word)):
+		lead := strings.TrimSpace(s[f.segStart:start])
+		if lead != "" && !(lead == "?" && f.first) {
+			return frame{}, false
+		}
+		if isCondition(word) {
+			return frame{kind: condKind}, true
+		}
+		return frame{kind: chainKind, segStart: i + 1, first: true}, true
+	case f.kind == condKind && word == "in":
+		return frame{kind: listKind}, start > 0 && (s[start-1] == ' ' || s[start-1] == '\t')
+	}
+	return frame{}, false
+}
+
+// wordBefore returns the identifier that ends just before s[i], spaces aside,
+// and its offset.
+func wordBefore(s string, i int) (start int, word string) {
+	end := i
+	for end > 0 && (s[end-1] == ' ' || s[end-1] == '\t') {
+		end--
+	}
+	start = end
+	for start > 0 && isIdent(s[start-1:start]) {
+		start--
+	}
+	return start, s[start:end]
+}
+
+// splitGroup reports whether seg is a group: a group, condition, or
+// combinator name immediately followed by a parenthesised span that closes at
+// the very end of the segment, as in "each(trim;lower)". It returns the name
+// and the text between the parentheses.
+func splitGroup(seg string) (op, inner string, ok bool) {
+	s := strings.TrimSpace(seg)
+	open := strings.IndexByte(s, '(')
+	if open <= 0 || s[len(s)-1] != ')' {
+		return "", "", false
+	}
+	op = strings.TrimSpace(s[:open])
+	if !isIdent(op) {
+		return "", "", false
+	}
+	// The '(' must open a group, matched by the final ')' rather than an
+	// earlier one as in "each(a)(b)": nothing from it on may be outside the
+	// group.
+	ok = true
+	unclosed := scanTop(s, func(i, depth int) {
+		if i >= open && depth == 0 {
+			ok = false
+		}
+	})
+	if !ok || len(unclosed) > 0 {
+		return "", "", false
+	}
+	return op, s[open+1 : len(s)-1], true
+}
+
+// isIdent reports whether s is a non-empty run of letters, digits, '_', and
+// '-', the characters a group name may use.
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
 }
 
 // isQuoted reports whether s is wrapped in a matching pair of single quotes.
@@ -70,43 +228,174 @@ func unquote(s string) string {
 	return inner
 }
 
-// splitChain splits a tag value into its directive segments on ';' (outside
-// quotes), dropping any empty or whitespace-only segment. A leading, trailing,
-// or doubled ';' is therefore harmless rather than an error.
-func splitChain(tagValue string) []string {
-	parts := splitTopN(tagValue, ';', -1)
-	segs := make([]string, 0, len(parts))
-	for _, p := range parts {
-		if strings.TrimSpace(p) != "" {
-			segs = append(segs, p)
+// checkNamedArgs returns a *ParamParseError for the first bare arg in args,
+// for callers that take key=value args only.
+func checkNamedArgs(seg span, args []Arg) error {
+	for _, a := range args {
+		if a.Key == "" {
+			pos := span{src: seg.src, text: seg.src[a.Pos:a.End], pos: a.Pos}.position()
+			return &ParamParseError{Pair: seg.src[a.Pos:a.End], Position: pos}
 		}
 	}
-	return segs
+	return nil
 }
 
-// splitTagValue parses one directive segment into its name and args. The name is
-// the text before the first top-level ',', and each remaining comma-separated
-// field is a key=value pair (see kv).
-func splitTagValue(tagVal string) (id string, args map[string]string, err error) {
-	parts := splitTopN(tagVal, ',', -1)
-	id = strings.TrimSpace(parts[0])
-	if id == "" {
-		return "", nil, &DirectiveParseError{TagValue: tagVal}
+// argMap returns args as a map; a key given twice keeps its last value.
+func argMap(args []Arg) map[string]string {
+	m := make(map[string]string, len(args))
+	for _, a := range args {
+		m[a.Key] = a.Value
 	}
-	args, err = extractPairs(parts[1:])
-	return id, args, err
+	return m
 }
 
-func extractPairs(args []string) (map[string]string, error) {
-	pairs := make(map[string]string)
-	for _, pair := range args {
-		k, v, err := kv(pair)
+// parseDirective parses the directive segment seg into its name and args, in
+// order with their positions. The name is the text before the first top-level
+// ',', and each remaining comma-separated field is a key=value pair (see kv)
+// or, with no top-level '=', a bare arg: its Key is "" and its Value the
+// unquoted text. A group whose '(' is never closed is a *DirectiveParseError.
+// A parse error carries its Position in seg.src. The name is returned even
+// when an arg fails to parse.
+func parseDirective(seg span) (id string, args []Arg, err error) {
+	if open := scanTop(seg.text, func(int, int) {}); len(open) > 0 {
+		start, _ := wordBefore(seg.text, open[0])
+		at := span{src: seg.src, text: seg.text[start:], pos: seg.pos + start}
+		return "", nil, &DirectiveParseError{TagValue: seg.text, Reason: "unclosed (", Position: at.position()}
+	}
+	parts := seg.split(',')
+	name := parts[0].trim()
+	if name.text == "" {
+		return "", nil, &DirectiveParseError{TagValue: seg.text, Position: name.position()}
+	}
+	for _, p := range parts[1:] {
+		if pair := p.trim(); len(splitTopN(pair.text, '=', 2)) == 1 {
+			// A bare (positional or flag) arg: just a value.
+			if pair.text == "" {
+				return name.text, nil, &ParamParseError{Pair: "", Position: pair.position()}
+			}
+			args = append(args, Arg{
+				Value:    unquote(pair.text),
+				Pos:      pair.pos,
+				End:      pair.end(),
+				ValuePos: pair.pos,
+			})
+			continue
+		}
+		k, v, err := kv(p.text)
 		if err != nil {
-			return nil, err
+			pe := err.(*ParamParseError)
+			pe.Position = p.trim().position()
+			return name.text, nil, pe
+		}
+		pair := p.trim()
+		value := pair.text[strings.IndexByte(pair.text, '=')+1:]
+		args = append(args, Arg{
+			Key:      k,
+			Value:    v,
+			Pos:      pair.pos,
+			End:      pair.end(),
+			ValuePos: pair.end() - len(strings.TrimLeftFunc(value, unicode.IsSpace)),
+		})
+	}
+	return name.text, args, nil
+}
+
+// span is a piece of a tag value being parsed: text, which starts at byte
+// offset pos of src, the whole value. Parsing through spans lets an error
+// point at the text at fault in src.
+type span struct {
+	src  string
+	text string
+	pos  int
+}
+
+// wholeSpan returns the span of all of s.
+func wholeSpan(s string) span {
+	return span{src: s, text: s}
+}
+
+func (s span) end() int {
+	return s.pos + len(s.text)
+}
+
+// split splits s like splitTopN(s.text, sep, -1), keeping each field's
+// position.
+func (s span) split(sep byte) []span {
+	parts := splitTopN(s.text, sep, -1)
+	out := make([]span, len(parts))
+	pos := s.pos
+	for i, p := range parts {
+		out[i] = span{src: s.src, text: p, pos: pos}
+		pos += len(p) + 1
+	}
+	return out
+}
+
+// chain splits s into its segments on ';' (outside quotes and groups), each
+// trimmed, dropping any blank one: a leading, trailing, or doubled ';' is
+// therefore harmless rather than an error.
+func (s span) chain() []span {
+	var segs []span
+	for _, p := range s.split(';') {
+		if t := p.trim(); t.text != "" {
+			segs = append(segs, t)
+		}
+	}
+	return segs
+}
+
+// trim trims the whitespace around s.
+func (s span) trim() span {
+	left := strings.TrimLeftFunc(s.text, unicode.IsSpace)
+	return span{
+		src:  s.src,
+		text: strings.TrimRightFunc(left, unicode.IsSpace),
+		pos:  s.pos + len(s.text) - len(left),
+	}
+}
+
+// group is splitGroup for a span: it returns the group's identifier and the
+// span between its parentheses.
+func (s span) group() (op string, inner span, ok bool) {
+	t := s.trim()
+	op, text, ok := splitGroup(t.text)
+	if !ok {
+		return "", span{}, false
+	}
+	return op, span{src: s.src, text: text, pos: t.pos + strings.IndexByte(t.text, '(') + 1}, true
+}
+
+// cutCondition splits s, the inside of a when/unless group, around the ':'
+// ending its condition. A ':' inside quotes or the condition's "in (...)"
+// list doesn't count.
+func (s span) cutCondition() (cond, rest span, found bool) {
+	parts := splitIn(s.text, ':', 2, frame{kind: condKind})
+	if len(parts) < 2 {
+		return s, span{}, false
+	}
+	at := s.pos + len(parts[0]) + 1
+	return span{src: s.src, text: parts[0], pos: s.pos}, span{src: s.src, text: parts[1], pos: at}, true
+}
+
+// position locates s for an error: its offset and length in s.src, and the
+// index of the src segment holding it.
+func (s span) position() Position {
+	return Position{Source: s.src, Segment: segmentIndex(s.src, s.pos), Offset: s.pos, Len: len(s.text)}
+}
+
+// segmentIndex returns the index of the segment of the chain src holding the
+// byte offset off, counting as Parse does: blank segments and a leading
+// omitempty modifier don't count.
+func segmentIndex(src string, off int) int {
+	segs, _ := cutOmitEmpty(wholeSpan(src).chain())
+	n := 0
+	for i, seg := range segs {
+		if seg.pos > off {
+			break
 		}
-		pairs[k] = v
+		n = i
 	}
-	return pairs, nil
+	return n
 }
 
 // kv splits a "key=value" pair on its first top-level '=', so a value may itself
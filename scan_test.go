@@ -26,6 +26,15 @@ func TestSplitTopN(t *testing.T) {
 		{"n=1 is whole", "a;b;c", ';', 1, []string{"a;b;c"}},
 		{"unbalanced quote swallows sep", "'a;b", ';', -1, []string{"'a;b"}},
 		{"sep right after closing quote", "'a';b", ';', -1, []string{"'a'", "b"}},
+		{"sep inside parens ignored", "each(a;b);c", ';', -1, []string{"each(a;b)", "c"}},
+		{"nested parens", "each(keys(a;b));c", ';', -1, []string{"each(keys(a;b))", "c"}},
+		{"quoted paren doesn't count", "p='(';q", ';', -1, []string{"p='('", "q"}},
+		{"unmatched close ignored", "a);b", ';', -1, []string{"a)", "b"}},
+		{"plain paren doesn't group", "contains, sub=(;trim", ';', -1, []string{"contains, sub=(", "trim"}},
+		{"plain paren in a pair", "a, x=(, y=2", ',', -1, []string{"a", " x=(", " y=2"}},
+		{"condition list groups", "when(A in (x;y): b);c", ';', -1, []string{"when(A in (x;y): b)", "c"}},
+		{"list outside a condition doesn't group", "note, text=x in (a;b)", ';', -1, []string{"note, text=x in (a", "b)"}},
+		{"group after a condition", "when(A: trim; any(a;b));c", ';', -1, []string{"when(A: trim; any(a;b))", "c"}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -37,6 +46,32 @@ func TestSplitTopN(t *testing.T) {
 	}
 }
 
+func TestSplitGroup(t *testing.T) {
+	tests := []struct {
+		seg, op, inner string
+		ok             bool
+	}{
+		{"each(trim;lower)", "each", "trim;lower", true},
+		{"  keys( lower ) ", "keys", " lower ", true},
+		{"each()", "each", "", true},
+		{"each(values(a))", "each", "values(a)", true},
+		{"each(p=')')", "each", "p=')'", true},
+		{"any(a; all(b;c))", "any", "a; all(b;c)", true},
+		{"each(a)(b)", "", "", false},
+		{"each(a", "", "", false},
+		{"each(contains, sub=()", "each", "contains, sub=(", true},
+		{"(a)", "", "", false},
+		{"regex, pattern=(a|b)", "", "", false},
+		{"trim", "", "", false},
+	}
+	for _, tt := range tests {
+		op, inner, ok := splitGroup(tt.seg)
+		if op != tt.op || inner != tt.inner || ok != tt.ok {
+			t.Errorf("splitGroup(%q) = %q, %q, %v; want %q, %q, %v", tt.seg, op, inner, ok, tt.op, tt.inner, tt.ok)
+		}
+	}
+}
+
 func TestUnquote(t *testing.T) {
 	tests := []struct{ in, want string }{
 		{"abc", "abc"},
@@ -195,3 +230,39 @@ func FuzzUnquote(f *testing.F) {
 		}
 	})
 }
+
+// splitChain splits a tag value into its trimmed directive segments.
+func splitChain(tagValue string) []string {
+	var segs []string
+	for _, seg := range wholeSpan(tagValue).chain() {
+		segs = append(segs, seg.text)
+	}
+	return segs
+}
+
+// splitTagValue parses one key=value-only directive segment into its name and
+// args map, the way a macro's args are parsed.
+func splitTagValue(tagVal string) (id string, args map[string]string, err error) {
+	seg := wholeSpan(tagVal)
+	id, list, err := parseDirective(seg)
+	if err == nil {
+		err = checkNamedArgs(seg, list)
+	}
+	if err != nil {
+		return id, nil, err
+	}
+	return id, argMap(list), nil
+}
+
+// extractPairs parses each of args with kv into one map.
+func extractPairs(args []string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, pair := range args {
+		k, v, err := kv(pair)
+		if err != nil {
+			return nil, err
+		}
+		pairs[k] = v
+	}
+	return pairs, nil
+}
@@ -0,0 +1,81 @@
+package tagex
+
+// ProcessParamsStrict is ProcessParams that also rejects args naming no
+// param-tagged field of data: the first such arg, in key order, is an
+// *UnknownParamError suggesting the closest declared param. It is the strict
+// counterpart used by a Tag with SetStrictParams on, for callers that apply
+// params without a Tag.
+func ProcessParamsStrict(data any, args map[string]string) error {
+	return processArgs(data, namedArgs(args), paramConfig{strict: true})
+}
+
+// segmentArgs is parseDirective for a segment compiled by t: when t is strict,
+// a repeated key is a *DuplicateParamError rather than overriding.
+func (t *Tag) segmentArgs(seg span) (string, []Arg, error) {
+	name, list, err := parseDirective(seg)
+	if err == nil && t.strictParams {
+		err = checkDuplicateArgs(seg, list)
+	}
+	if err != nil {
+		return name, nil, err
+	}
+	return name, list, nil
+}
+
+// checkDuplicateArgs returns a *DuplicateParamError for the second occurrence
+// of the first key args repeats. Bare args have no key and are not checked.
+func checkDuplicateArgs(seg span, args []Arg) error {
+	for i, a := range args {
+		if a.Key == "" {
+			continue
+		}
+		for _, b := range args[:i] {
+			if a.Key == b.Key {
+				pos := span{src: seg.src, text: seg.src[a.Pos:a.End], pos: a.Pos}.position()
+				return &DuplicateParamError{Param: a.Key, Position: pos}
+			}
+		}
+	}
+	return nil
+}
+
+// closest returns the name in names nearest to s by edit distance, or "" if
+// none is near enough to be a plausible typo: at most one edit per two
+// characters of s, and at least one.
+func closest(s string, names []string) string {
+	best, bestDist := "", max(1, len(s)/2)+1
+	for _, n := range names {
+		if d := editDistance(s, n); d < bestDist {
+			best, bestDist = n, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the optimal string alignment distance between a and b:
+// the fewest insertions, deletions, substitutions, and transpositions of
+// adjacent bytes that turn a into b.
+func editDistance(a, b string) int {
+	// d[i][j] is the distance between a[:i] and b[:j].
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,95 @@
+package tagex
+
+import (
+	"errors"
+	"testing"
+)
+
+func strictTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := chainTag(t)
+	tag.SetStrictParams(true)
+	return tag
+}
+
+func TestStrictParams_UnknownKey(t *testing.T) {
+	type form struct {
+		S string `val:"trim;length, mni=3, max=5"`
+	}
+	// Lenient by default: the typo is ignored and min is missing instead.
+	var missing *MissingParamError
+	if err := chainTag(t).ProcessStruct(&form{}); !errors.As(err, &missing) {
+		t.Fatalf("lenient: want a *MissingParamError, got %v", err)
+	}
+
+	err := strictTag(t).ProcessStruct(&form{})
+	var pe *ProcessError
+	if !errors.As(err, &pe) || pe.Stage != StageParam || pe.Directive != "length" || pe.Param != "mni" {
+		t.Fatalf("want a StageParam failure of length param mni, got %v", err)
+	}
+	var ue *UnknownParamError
+	if !errors.As(err, &ue) || ue.Suggestion != "min" {
+		t.Fatalf("want an *UnknownParamError suggesting min, got %v", err)
+	}
+}
+
+func TestStrictParams_DuplicateKey(t *testing.T) {
+	type form struct {
+		S string `val:"length, min=1, max=5, min=2"`
+	}
+	if err := chainTag(t).ProcessStruct(&form{S: "a"}); err == nil {
+		t.Fatal("lenient: the last min=2 should apply")
+	}
+
+	err := strictTag(t).ProcessStruct(&form{S: "a"})
+	var de *DuplicateParamError
+	if !errors.As(err, &de) || de.Param != "min" || de.Offset != 22 {
+		t.Fatalf("want a *DuplicateParamError for the second min, got %v", err)
+	}
+}
+
+// A misspelled flag is a bare arg no param takes; strict mode suggests the
+// flag it resembles.
+func TestStrictParams_MisspelledFlag(t *testing.T) {
+	type form struct {
+		S string `val:"trim;pad, 4, lfet"`
+	}
+	tag := positionalTag(t)
+	var pe *ParamParseError
+	if err := tag.ProcessStruct(&form{}); !errors.As(err, &pe) || pe.Suggestion != "" {
+		t.Fatalf("lenient: want a *ParamParseError with no suggestion, got %v", err)
+	}
+	tag.SetStrictParams(true)
+	err := tag.ProcessStruct(&form{})
+	if !errors.As(err, &pe) || pe.Pair != "lfet" || pe.Suggestion != "left" || pe.Offset != 13 {
+		t.Fatalf("want a *ParamParseError for lfet suggesting left, got %v", err)
+	}
+}
+
+func TestProcessParamsStrict(t *testing.T) {
+	err := ProcessParamsStrict(&LengthDirective{}, map[string]string{"min": "1", "max": "2", "colour": "red"})
+	var ue *UnknownParamError
+	if !errors.As(err, &ue) || ue.Param != "colour" || ue.Suggestion != "" {
+		t.Fatalf("want an *UnknownParamError for colour with no suggestion, got %v", err)
+	}
+	if err := ProcessParamsStrict(&LengthDirective{}, map[string]string{"min": "1", "max": "2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClosest(t *testing.T) {
+	names := []string{"min", "max", "pattern"}
+	tests := map[string]string{
+		"mni":     "min",
+		"maxx":    "max",
+		"patern":  "pattern",
+		"ptatern": "pattern",
+		"x":       "",
+		"length":  "",
+	}
+	for in, want := range tests {
+		if got := closest(in, names); got != want {
+			t.Errorf("closest(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
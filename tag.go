@@ -1,6 +1,7 @@
 package tagex
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -12,9 +13,81 @@ import (
 // It owns the set of directives and converters used when processing
 // tagged struct fields.
 type Tag struct {
-	Key               string
-	mut               sync.RWMutex
-	directiveRegistry map[string]anyDirective
+	Key string
+	mut sync.RWMutex
+	// directiveRegistry maps a directive name to its overloads, one per
+	// field type T, in registration order.
+	directiveRegistry map[string][]anyDirective
+
+	// plans caches each struct type's compiled plan (reflect.Type ->
+	// *structPlan). It is reset whenever the registry changes; see plan.go.
+	plans sync.Map
+
+	ifacePolicy       InterfacePolicy
+	convertUnderlying bool
+	strictParams      bool
+	converters        map[reflect.Type]converter
+	variables         map[string]string
+	unwrappers        map[reflect.Type]unwrapper
+	macros            map[string]string
+	maxDepth          int
+	cycles            CycleMode
+}
+
+// InterfacePolicy decides how processing treats a struct or array held
+// directly (not through a pointer) in an interface-typed field. Such a dynamic
+// value is a copy that cannot be addressed, so MutMode directives inside it
+// cannot write in place. Pointers, slices, and maps held in an interface are
+// always walked and written through; the policy does not apply to them.
+type InterfacePolicy int
+
+const (
+	// InterfaceCopy processes an addressable copy of the value and assigns it
+	// back to the interface field, as map values are. This is the default.
+	InterfaceCopy InterfacePolicy = iota
+	// InterfaceEval processes a copy and discards it: directives evaluate,
+	// but MutMode results are not written back.
+	InterfaceEval
+	// InterfaceSkip leaves the value alone; its fields are not processed.
+	InterfaceSkip
+)
+
+// SetInterfacePolicy sets how t treats non-addressable values held in
+// interface fields (see InterfacePolicy). When several tags are processed in
+// one call, the most conservative of their policies applies (InterfaceSkip
+// over InterfaceEval over InterfaceCopy).
+func (t *Tag) SetInterfacePolicy(p InterfacePolicy) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.ifacePolicy = p
+}
+
+// SetConvertUnderlying turns named-type conversion on or off for every
+// directive on t. With it on, a directive for T also applies to a field whose
+// type is a different named type with T's underlying type — a Directive[string]
+// to type Email string, a Directive[int64] to type UserID int64. The field is
+// converted to T for the directive and, in MutMode, the result converted back.
+// Only types of the same kind that convert both ways qualify, so no conversion
+// changes a value's representation. A single directive can opt in by itself
+// with UnderlyingConverter.
+func (t *Tag) SetConvertUnderlying(on bool) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.convertUnderlying = on
+	t.resetPlans()
+}
+
+// SetStrictParams turns strict parameter checking on or off for t. With it
+// on, a tag arg that names no param of its directive is an *UnknownParamError
+// suggesting the closest declared param, and a key given twice in one segment
+// is a *DuplicateParamError; both are reported at StageParam. With it off,
+// the default, unknown args are ignored and a repeated key keeps its last
+// value.
+func (t *Tag) SetStrictParams(on bool) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.strictParams = on
+	t.resetPlans()
 }
 
 // NewTag creates a new Tag for the given struct tag key.
@@ -25,7 +98,7 @@ func NewTag(key string) *Tag {
 
 func (t *Tag) initDirectiveRegistry() {
 	if t.directiveRegistry == nil {
-		t.directiveRegistry = make(map[string]anyDirective)
+		t.directiveRegistry = make(map[string][]anyDirective)
 	}
 }
 
@@ -34,19 +107,33 @@ func (t *Tag) setDirective(name string, d anyDirective) error {
 	defer t.mut.Unlock()
 
 	t.initDirectiveRegistry()
-	if _, exists := t.directiveRegistry[name]; exists {
+	if _, exists := t.macros[name]; exists {
 		return &DuplicateDirectiveError{Name: name}
 	}
-	t.directiveRegistry[name] = d
+	// Overloads are chosen by exact type, so two are ambiguous only when they
+	// handle the same T.
+	for _, o := range t.directiveRegistry[name] {
+		if o.valueType() == d.valueType() {
+			return &DuplicateDirectiveError{Name: name, Type: d.valueType()}
+		}
+	}
+	t.directiveRegistry[name] = append(t.directiveRegistry[name], d)
+	t.resetPlans() // compiled plans may have resolved name as unknown
 	return nil
 }
 
-func (t *Tag) directive(name string) (anyDirective, bool) {
+func (t *Tag) directive(name string) ([]anyDirective, bool) {
 	t.mut.RLock()
 	defer t.mut.RUnlock()
 
 	// Reading a nil map is safe; the registry is created lazily by
 	// setDirective under the write lock, so no init is needed here.
+	return t.lookup(name)
+}
+
+// lookup is directive without the locking, for callers that already hold t.mut
+// (plan compilation runs inside ProcessStruct's read lock).
+func (t *Tag) lookup(name string) ([]anyDirective, bool) {
 	d, ok := t.directiveRegistry[name]
 	return d, ok
 }
@@ -105,20 +192,159 @@ func wrapFieldError(fieldName string, err error) error {
 	}
 }
 
-// maxDepth bounds recursion so that cyclic data (a struct that reaches itself
-// through a pointer, slice, or map) returns a *MaxDepthError instead of
-// overflowing the stack. It is far deeper than any real struct nests, so legit
-// acyclic data never hits it.
+// maxDepth is the default recursion bound, so that cyclic data (a struct that
+// reaches itself through a pointer, slice, or map) returns a *MaxDepthError
+// instead of overflowing the stack. It is far deeper than typical structs nest;
+// a Tag that processes deeper acyclic trees can raise it with SetMaxDepth.
 const maxDepth = 1000
 
-// processStructFields walks val's fields applying directives. When errs is nil
-// it stops at the first field failure (returning it); when non-nil, field
-// failures are appended to *errs and processing continues. A structural error
-// (e.g. the depth limit, from processValue) is always returned and stops both
-// modes.
-func processStructFields(tags []*Tag, val reflect.Value, path string, depth int, errs *[]error) error {
+// CycleMode selects whether processing tracks the pointers, maps, and slices on
+// the current walk path to detect cycles precisely, the way encoding/json does,
+// instead of relying on the depth limit alone.
+type CycleMode int
+
+const (
+	// CycleOff does no tracking; cyclic data is stopped by the depth limit
+	// with a *MaxDepthError. This is the default.
+	CycleOff CycleMode = iota
+	// CycleSkip stops descending at a node already on the walk path, so each
+	// node of a cycle is processed once and no error is reported.
+	CycleSkip
+	// CycleReport stops at a node already on the walk path with a
+	// *CycleError naming both paths.
+	CycleReport
+)
+
+// SetMaxDepth sets how deep processing may recurse before it stops with a
+// *MaxDepthError. n <= 0 restores the default (1000). When several tags are
+// processed in one call, the smallest limit among them applies, so no tag
+// recurses deeper than it allows; a tag left at the default counts as 1000.
+func (t *Tag) SetMaxDepth(n int) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.maxDepth = n
+}
+
+// SetCycleMode opts t into pointer-identity cycle detection (see CycleMode).
+// Only nodes on the current path count, so data shared between siblings (a DAG)
+// is processed at each place it appears and is not mistaken for a cycle. When
+// several tags are processed in one call, the strictest mode among them applies
+// (CycleReport over CycleSkip over CycleOff).
+func (t *Tag) SetCycleMode(m CycleMode) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.cycles = m
+}
+
+// walker carries the state of one ProcessStruct call through the recursive
+// walk: the context, the tags being applied, where errors go, and the walk
+// settings merged from the tags (see newWalker).
+type walker struct {
+	ctx  context.Context
+	tags []*Tag
+	// errs is nil to stop at the first field failure; when non-nil, field
+	// failures are appended to it and processing continues.
+	errs     *[]error
+	iface    InterfacePolicy
+	maxDepth int
+	cycles   CycleMode
+	// visiting maps each pointer, map, and slice on the current walk path to
+	// the path where it was entered. It is only used when cycles != CycleOff.
+	visiting map[visitKey]string
+}
+
+// visitKey identifies a node for cycle detection. The type tells apart a
+// pointer to a struct from a pointer to its first field, and the length tells
+// apart slices sharing a backing array.
+type visitKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// newWalker builds the walker for one call. Walk settings are per Tag, but a
+// call walks the struct once for all its tags, so they are merged: the most
+// conservative interface policy, the smallest depth limit, and the strictest
+// cycle mode win. The caller holds every tag's read lock.
+func newWalker(ctx context.Context, tags []*Tag, errs *[]error) *walker {
+	w := &walker{ctx: ctx, tags: tags, errs: errs}
+	for _, tag := range tags {
+		if tag == nil {
+			continue
+		}
+		if tag.ifacePolicy > w.iface {
+			w.iface = tag.ifacePolicy
+		}
+		limit := tag.maxDepth
+		if limit <= 0 {
+			limit = maxDepth
+		}
+		if w.maxDepth == 0 || limit < w.maxDepth {
+			w.maxDepth = limit
+		}
+		if tag.cycles > w.cycles {
+			w.cycles = tag.cycles
+		}
+	}
+	if w.maxDepth == 0 {
+		w.maxDepth = maxDepth
+	}
+	if w.cycles != CycleOff {
+		w.visiting = make(map[visitKey]string)
+	}
+	return w
+}
+
+// enter records the pointer, map, or slice val as being on the walk path at
+// path. It returns ok=false when val is already on the path — a cycle — along
+// with the error to return for it: nil under CycleSkip, a *CycleError wrapped
+// in a *ProcessError under CycleReport. When ok, the caller must call leave
+// once it has finished descending into val.
+func (w *walker) enter(val reflect.Value, path string) (key visitKey, ok bool, err error) {
+	key = visitKey{ptr: val.Pointer(), typ: val.Type()}
+	if val.Kind() == reflect.Slice {
+		key.len = val.Len()
+	}
+	if first, seen := w.visiting[key]; seen {
+		if w.cycles == CycleSkip {
+			return key, false, nil
+		}
+		return key, false, &ProcessError{
+			Stage:     StageStruct,
+			FieldPath: truncatePath(path),
+			Cause:     &CycleError{Path: truncatePath(path), FirstPath: first},
+		}
+	}
+	w.visiting[key] = path
+	return key, true, nil
+}
+
+func (w *walker) leave(key visitKey) {
+	delete(w.visiting, key)
+}
+
+// processStructFields walks val's fields applying directives. In
+// short-circuit mode (w.errs nil) it stops at the first field failure,
+// returning it; in accumulate mode field failures are recorded and processing
+// continues. A structural error (e.g. the depth limit, from processValue, or
+// the context being cancelled) is always returned and stops both modes.
+func (w *walker) processStructFields(val reflect.Value, path string, depth int) error {
+	typ := val.Type()
+
+	// Each Tag's compiled plan for this type, looked up once per struct rather
+	// than per field. The array keeps the common few-tag case off the heap.
+	var buf [4]*structPlan
+	plans := buf[:0]
+	for _, tag := range w.tags {
+		if tag == nil {
+			plans = append(plans, nil)
+			continue
+		}
+		plans = append(plans, tag.plan(typ))
+	}
+
 	for n := 0; n < val.NumField(); n++ {
-		field := val.Type().Field(n)
+		field := typ.Field(n)
 		if field.PkgPath != "" { // unexported
 			continue
 		}
@@ -126,25 +352,30 @@ func processStructFields(tags []*Tag, val reflect.Value, path string, depth int,
 		fieldValue := val.Field(n)
 		fieldPath := joinPath(path, field.Name)
 
-		for _, tag := range tags {
-			if tag == nil {
+		if err := w.ctx.Err(); err != nil {
+			return contextError(fieldPath, err)
+		}
+
+		for i, tag := range w.tags {
+			if plans[i] == nil {
 				continue
 			}
-			if tagValue, ok := field.Tag.Lookup(tag.Key); ok {
-				if err := processDirective(tag, tagValue, fieldValue); err != nil {
+			if chain := plans[i].fields[n]; chain != nil {
+				info := FieldInfo{Field: field, Path: fieldPath, TagKey: tag.Key, Parent: val, parentPath: path}
+				if err := chain.run(w.ctx, fieldValue, &info); err != nil {
 					e := &TagError{
 						TagKey: tag.Key,
 						Err:    wrapFieldError(fieldPath, err),
 					}
-					if errs == nil {
+					if w.errs == nil {
 						return e // short-circuit: stop at the first failure
 					}
-					*errs = append(*errs, e) // accumulate: record and keep going
+					*w.errs = append(*w.errs, e) // accumulate: record and keep going
 				}
 			}
 		}
 
-		if err := processValue(tags, fieldValue, fieldPath, depth+1, errs); err != nil {
+		if err := w.processValue(fieldValue, fieldPath, depth+1); err != nil {
 			return err // structural error (e.g. depth limit); stops both modes
 		}
 	}
@@ -153,36 +384,57 @@ func processStructFields(tags []*Tag, val reflect.Value, path string, depth int,
 }
 
 // processValue descends into val to reach any nested struct fields, recursing
-// through pointers, slices, arrays, and maps. Paths gain "[i]" for indexed
-// elements and "[key]" for map entries (e.g. Items[2].SKU). depth bounds the
-// recursion against cyclic data (see maxDepth).
-func processValue(tags []*Tag, val reflect.Value, path string, depth int, errs *[]error) error {
-	if depth > maxDepth {
+// through pointers, interfaces, slices, arrays, and maps. Paths gain "[i]" for
+// indexed elements, "[key]" for map entries (e.g. Items[2].SKU), and ".(T)" for
+// an interface's dynamic type (e.g. Payload.(*app.Created).ID). depth bounds
+// the recursion against cyclic data (see maxDepth).
+func (w *walker) processValue(val reflect.Value, path string, depth int) error {
+	if depth > w.maxDepth {
 		// Wrap like every other processing failure so errors.As(&ProcessError)
 		// works uniformly; the *MaxDepthError is the Cause. A depth/cycle error
 		// is structural: it is returned (never accumulated) and stops both modes.
 		return &ProcessError{
 			Stage:     StageStruct,
 			FieldPath: truncatePath(path),
-			Cause:     &MaxDepthError{Limit: maxDepth},
+			Cause:     &MaxDepthError{Limit: w.maxDepth},
 		}
 	}
+	if w.cycles != CycleOff && isTracked(val) {
+		key, ok, err := w.enter(val, path)
+		if !ok {
+			return err
+		}
+		defer w.leave(key)
+	}
 	switch val.Kind() {
 	case reflect.Struct:
-		return processStructFields(tags, val, path, depth, errs)
+		return w.processStructFields(val, path, depth)
 	case reflect.Ptr:
 		if val.IsNil() {
 			return nil
 		}
-		return processValue(tags, val.Elem(), path, depth+1, errs)
+		return w.processValue(val.Elem(), path, depth+1)
+	case reflect.Interface:
+		if val.IsNil() {
+			return nil
+		}
+		return w.processInterface(val, path, depth)
 	case reflect.Slice, reflect.Array:
 		for i := 0; i < val.Len(); i++ {
-			if err := processValue(tags, val.Index(i), fmt.Sprintf("%s[%d]", path, i), depth+1, errs); err != nil {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			if err := w.ctx.Err(); err != nil {
+				return contextError(elemPath, err)
+			}
+			if err := w.processValue(val.Index(i), elemPath, depth+1); err != nil {
 				return err
 			}
 		}
 	case reflect.Map:
 		for _, key := range val.MapKeys() {
+			elemPath := fmt.Sprintf("%s[%v]", path, key.Interface())
+			if err := w.ctx.Err(); err != nil {
+				return contextError(elemPath, err)
+			}
 			elem := val.MapIndex(key)
 			// Map values are not addressable, so MutMode directives can't write
 			// to them in place. Process an addressable copy and store it back.
@@ -190,7 +442,7 @@ func processValue(tags []*Tag, val reflect.Value, path string, depth int, errs *
 			// map-of-struct validation lands on a hot path.
 			c := reflect.New(elem.Type()).Elem()
 			c.Set(elem)
-			if err := processValue(tags, c, fmt.Sprintf("%s[%v]", path, key.Interface()), depth+1, errs); err != nil {
+			if err := w.processValue(c, elemPath, depth+1); err != nil {
 				return err
 			}
 			val.SetMapIndex(key, c)
@@ -200,6 +452,55 @@ func processValue(tags []*Tag, val reflect.Value, path string, depth int, errs *
 	return nil
 }
 
+// isTracked reports whether val is a node cycle detection records: a non-nil
+// pointer, or a non-empty map or slice.
+func isTracked(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Ptr:
+		return !val.IsNil()
+	case reflect.Map, reflect.Slice:
+		return val.Len() > 0
+	}
+	return false
+}
+
+// processInterface descends into the dynamic value of the non-nil interface
+// val. Pointers, slices, and maps reach addressable (or, for maps,
+// write-back-able) data, so they are walked like any other field and MutMode
+// writes through them. A struct or array held directly is a non-addressable
+// copy; w.iface decides what happens to it (see InterfacePolicy).
+func (w *walker) processInterface(val reflect.Value, path string, depth int) error {
+	elem := val.Elem()
+	elemPath := fmt.Sprintf("%s.(%s)", path, elem.Type())
+	switch elem.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return w.processValue(elem, elemPath, depth+1)
+	case reflect.Struct, reflect.Array:
+		if w.iface == InterfaceSkip {
+			return nil
+		}
+		c := reflect.New(elem.Type()).Elem()
+		c.Set(elem)
+		if err := w.processValue(c, elemPath, depth+1); err != nil {
+			return err
+		}
+		if w.iface == InterfaceCopy && val.CanSet() {
+			val.Set(c)
+		}
+	}
+	return nil
+}
+
+// contextError reports that processing stopped at path because ctx was done.
+// Like the depth limit it is structural: returned, never accumulated.
+func contextError(path string, err error) error {
+	return &ProcessError{
+		Stage:     StageStruct,
+		FieldPath: truncatePath(path),
+		Cause:     &ContextError{Err: err},
+	}
+}
+
 func joinPath(path, name string) string {
 	if path == "" {
 		return name
@@ -220,10 +521,34 @@ func (t *Tag) ProcessStructAll(data any) error {
 	return ProcessStructAll(data, t)
 }
 
+// ProcessStructContext is like ProcessStruct but passes ctx to context-aware
+// directives and stops when ctx is done. See ProcessStructContext.
+func (t *Tag) ProcessStructContext(ctx context.Context, data any) error {
+	return ProcessStructContext(ctx, data, t)
+}
+
+// ProcessStructAllContext is like ProcessStructAll but passes ctx to
+// context-aware directives and stops when ctx is done. See
+// ProcessStructContext.
+func (t *Tag) ProcessStructAllContext(ctx context.Context, data any) error {
+	return ProcessStructAllContext(ctx, data, t)
+}
+
 // ProcessStruct applies directives for multiple tags in a single pass, stopping
 // at the first failure. It returns nil on success.
 func ProcessStruct(data any, tags ...*Tag) error {
-	return processStruct(data, nil, tags...)
+	return processStruct(context.Background(), data, nil, tags...)
+}
+
+// ProcessStructContext is like ProcessStruct but carries ctx through the walk:
+// it is passed to every ContextDirective's HandleContext, and processing checks
+// it before each field and collection element. Once ctx is done, processing
+// stops and returns a *ProcessError whose Cause is a *ContextError wrapping
+// ctx.Err(), so errors.Is(err, context.Canceled) and
+// errors.Is(err, context.DeadlineExceeded) work. A directive that is already
+// running is not interrupted; it sees the cancellation through its own ctx.
+func ProcessStructContext(ctx context.Context, data any, tags ...*Tag) error {
+	return processStruct(ctx, data, nil, tags...)
 }
 
 // ProcessStructAll is like ProcessStruct but does not stop at the first failure:
@@ -236,13 +561,22 @@ func ProcessStruct(data any, tags ...*Tag) error {
 // fields after a failure are still mutated, because processing continues.
 func ProcessStructAll(data any, tags ...*Tag) error {
 	errs := make([]error, 0)
-	return processStruct(data, &errs, tags...)
+	return processStruct(context.Background(), data, &errs, tags...)
+}
+
+// ProcessStructAllContext is like ProcessStructAll but carries ctx through the
+// walk as ProcessStructContext does. Cancellation is structural: it stops
+// processing and is returned on its own rather than joined with the field
+// errors collected so far.
+func ProcessStructAllContext(ctx context.Context, data any, tags ...*Tag) error {
+	errs := make([]error, 0)
+	return processStruct(ctx, data, &errs, tags...)
 }
 
 // processStruct is the shared engine. When errs is nil it stops at the first
 // error (ProcessStruct); when non-nil, field errors accumulate into it and only
 // a structural error returns early (ProcessStructAll).
-func processStruct(data any, errs *[]error, tags ...*Tag) error {
+func processStruct(ctx context.Context, data any, errs *[]error, tags ...*Tag) error {
 	val, err := pointerStruct(data)
 	if err != nil {
 		return &ProcessError{Stage: StageInput, Cause: err}
@@ -274,7 +608,12 @@ func processStruct(data any, errs *[]error, tags ...*Tag) error {
 
 	// Process directives. In accumulate mode, field errors collect into errs and
 	// only a structural error (e.g. the depth limit) returns here.
-	cause := processStructFields(tags, val, "", 0, errs)
+	w := newWalker(ctx, tags, errs)
+	if w.cycles != CycleOff {
+		// The root is on the path too, so a cycle back to it names "".
+		w.enter(reflect.ValueOf(data), "")
+	}
+	cause := w.processStructFields(val, "", 0)
 	if cause == nil && errs != nil && len(*errs) > 0 {
 		cause = errors.Join(*errs...)
 	}
@@ -301,10 +640,12 @@ func processStruct(data any, errs *[]error, tags ...*Tag) error {
 }
 
 // RegisterDirective registers d with t under d.Name(); directives are looked up
-// by that name when processing struct fields. It returns an *EmptyDirectiveNameError
-// if the name is blank, or a *DuplicateDirectiveError if the name is already
-// registered on t. Use MustRegisterDirective to panic instead — appropriate for
-// registration done once at program startup.
+// by that name when processing struct fields. Several directives may share a
+// name if each handles a different T: a field is processed by the one whose T
+// is the field's type. It returns an *EmptyDirectiveNameError if the name is
+// blank, or a *DuplicateDirectiveError if a directive for the same name and T
+// is already registered on t. Use MustRegisterDirective to panic instead —
+// appropriate for registration done once at program startup.
 func RegisterDirective[T any](t *Tag, d Directive[T]) error {
 	name := d.Name()
 	if strings.TrimSpace(name) == "" {
@@ -313,9 +654,48 @@ func RegisterDirective[T any](t *Tag, d Directive[T]) error {
 	return t.setDirective(name, directiveWrapper[T]{Directive: d})
 }
 
+// RegisterContextDirective registers the context-aware directive d with t under
+// d.Name(), with the same errors as RegisterDirective. Its HandleContext
+// receives the context given to ProcessStructContext.
+func RegisterContextDirective[T any](t *Tag, d ContextDirective[T]) error {
+	name := d.Name()
+	if strings.TrimSpace(name) == "" {
+		return &EmptyDirectiveNameError{}
+	}
+	return t.setDirective(name, contextDirectiveWrapper[T]{ContextDirective: d})
+}
+
+// RegisterValueDirective registers the reflection-level directive d with t
+// under d.Name(), with the same errors as RegisterDirective. It may share a name
+// with typed directives: a field whose type none of them handles is processed
+// by d. At most one ValueDirective can be registered per name.
+func RegisterValueDirective(t *Tag, d ValueDirective) error {
+	name := d.Name()
+	if strings.TrimSpace(name) == "" {
+		return &EmptyDirectiveNameError{}
+	}
+	return t.setDirective(name, valueDirectiveWrapper{ValueDirective: d})
+}
+
+// MustRegisterValueDirective is like RegisterValueDirective but panics if
+// registration fails.
+func MustRegisterValueDirective(t *Tag, d ValueDirective) {
+	if err := RegisterValueDirective(t, d); err != nil {
+		panic(err)
+	}
+}
+
+// MustRegisterContextDirective is like RegisterContextDirective but panics if
+// registration fails.
+func MustRegisterContextDirective[T any](t *Tag, d ContextDirective[T]) {
+	if err := RegisterContextDirective(t, d); err != nil {
+		panic(err)
+	}
+}
+
 // MustRegisterDirective is like RegisterDirective but panics if registration
 // fails. It is intended for setup-time registration, where a blank or duplicate
-// directive name is a programming error that should fail fast at startup.
+// directive is a programming error that should fail fast at startup.
 func MustRegisterDirective[T any](t *Tag, d Directive[T]) {
 	if err := RegisterDirective(t, d); err != nil {
 		panic(err)
@@ -0,0 +1,148 @@
+package tagex
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// Nullable is implemented by optional-value wrappers — an Optional[T], a
+// nullable column type — so that directives for the wrapped type can see
+// through them. NullableValue returns a pointer to the wrapped value and
+// whether it is set; implement it on the pointer receiver so the pointer
+// reaches the wrapper's own field:
+//
+//	func (o *Optional[T]) NullableValue() (any, bool) { return &o.Val, o.Set }
+//
+// A Directive[T] on a field of such a type then runs on the wrapped T when it
+// is set and writes MutMode results back into the wrapper. An unset value is
+// treated like a nil pointer: skipped, unless the directive implements
+// NilHandler. For wrapper types you can't add methods to, use RegisterUnwrapper.
+type Nullable interface {
+	NullableValue() (ptr any, valid bool)
+}
+
+var nullableType = reflect.TypeFor[Nullable]()
+
+// unwrapper extracts the value a wrapper holds. w is the addressable wrapper;
+// inner is addressable, so MutMode writes land in the wrapper.
+type unwrapper func(w reflect.Value) (inner reflect.Value, valid bool)
+
+// RegisterUnwrapper lets directives on t see through the wrapper type W, the
+// way Nullable does for types that implement it: fn returns a pointer to the
+// value a *W holds and whether it is set. It returns an *UnwrapperError if fn
+// doesn't return a non-nil pointer for a zero W. Registering W again replaces
+// its unwrapper.
+//
+//	tagex.RegisterUnwrapper(tag, func(n *pgtype.Text) (any, bool) { return &n.String, n.Valid })
+//
+// The database/sql Null types (sql.NullString, sql.NullInt64, sql.Null[T],
+// and the rest) are unwrapped without registration.
+func RegisterUnwrapper[W any](t *Tag, fn func(w *W) (ptr any, valid bool)) error {
+	typ := reflect.TypeFor[W]()
+	if ptr, _ := fn(new(W)); !isValuePointer(ptr) {
+		return &UnwrapperError{Type: typ}
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.unwrappers == nil {
+		t.unwrappers = make(map[reflect.Type]unwrapper)
+	}
+	t.unwrappers[typ] = func(w reflect.Value) (reflect.Value, bool) {
+		ptr, valid := fn(w.Addr().Interface().(*W))
+		return reflect.ValueOf(ptr).Elem(), valid
+	}
+	t.resetPlans()
+	return nil
+}
+
+// MustRegisterUnwrapper is like RegisterUnwrapper but panics if registration
+// fails.
+func MustRegisterUnwrapper[W any](t *Tag, fn func(w *W) (ptr any, valid bool)) {
+	if err := RegisterUnwrapper(t, fn); err != nil {
+		panic(err)
+	}
+}
+
+func isValuePointer(ptr any) bool {
+	v := reflect.ValueOf(ptr)
+	return v.Kind() == reflect.Ptr && !v.IsNil()
+}
+
+// unwrapperFor returns how to unwrap the type typ and the type it wraps: a
+// registered unwrapper first, then Nullable, then the database/sql Null types.
+// The caller holds t.mut.
+func (t *Tag) unwrapperFor(typ reflect.Type) (unwrapper, reflect.Type, bool) {
+	u, ok := t.unwrappers[typ]
+	switch {
+	case ok:
+	case reflect.PointerTo(typ).Implements(nullableType):
+		u = func(w reflect.Value) (reflect.Value, bool) {
+			ptr, valid := w.Addr().Interface().(Nullable).NullableValue()
+			if !isValuePointer(ptr) {
+				return reflect.Value{}, false
+			}
+			return reflect.ValueOf(ptr).Elem(), valid
+		}
+	case isSQLNull(typ):
+		u = func(w reflect.Value) (reflect.Value, bool) {
+			return w.Field(0), w.Field(1).Bool()
+		}
+	default:
+		return nil, nil, false
+	}
+	// Probe a zero wrapper for the wrapped type.
+	inner, _ := u(reflect.New(typ).Elem())
+	if !inner.IsValid() || inner.Type() == typ {
+		return nil, nil, false
+	}
+	return u, inner.Type(), true
+}
+
+// isSQLNull reports whether typ is one of database/sql's Null types: a struct
+// named Null... holding the value and a Valid bool.
+func isSQLNull(typ reflect.Type) bool {
+	return typ.PkgPath() == "database/sql" &&
+		strings.HasPrefix(typ.Name(), "Null") &&
+		typ.Kind() == reflect.Struct &&
+		typ.NumField() == 2 &&
+		typ.Field(1).Name == "Valid" &&
+		typ.Field(1).Type.Kind() == reflect.Bool
+}
+
+// unwrapDirective runs a directive on the value a wrapper holds, and handles
+// an unset wrapper like a nil pointer.
+type unwrapDirective struct {
+	anyDirective
+	unwrap unwrapper
+}
+
+func (d unwrapDirective) clone() anyDirective {
+	return unwrapDirective{anyDirective: d.anyDirective.clone(), unwrap: d.unwrap}
+}
+
+func (d unwrapDirective) HandleAny(val reflect.Value) error {
+	return d.handle(context.Background(), val, &FieldInfo{})
+}
+
+func (d unwrapDirective) handle(ctx context.Context, val reflect.Value, field *FieldInfo) error {
+	copied := !val.CanAddr()
+	if copied {
+		// Unwrapping needs the wrapper's address; work on a copy, which
+		// MutMode can't write back, so its result is a *FieldSetError.
+		c := reflect.New(val.Type()).Elem()
+		c.Set(val)
+		val = c
+	}
+	inner, valid := d.unwrap(val)
+	if !valid {
+		return handleNil(ctx, d.anyDirective, field)
+	}
+	if err := d.anyDirective.handle(ctx, inner, field); err != nil {
+		return err
+	}
+	if copied && directiveMode(d.anyDirective) == MutMode {
+		return &FieldSetError{Msg: "unable to set field value"}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package tagex
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type optional[T any] struct {
+	Val T
+	Set bool
+}
+
+func (o *optional[T]) NullableValue() (any, bool) { return &o.Val, o.Set }
+
+// legacyText is a wrapper without methods, unwrapped through RegisterUnwrapper.
+type legacyText struct {
+	Text  string
+	Valid bool
+}
+
+type positive struct{}
+
+func (d *positive) Name() string        { return "positive" }
+func (d *positive) Mode() DirectiveMode { return EvalMode }
+func (d *positive) Handle(val int64) (int64, error) {
+	if val <= 0 {
+		return val, errors.New("must be positive")
+	}
+	return val, nil
+}
+
+type row struct {
+	Name   sql.NullString   `val:"trim;length, min=2, max=10"`
+	Count  sql.NullInt64    `val:"positive"`
+	Alias  sql.Null[string] `val:"trim"`
+	Nick   optional[string] `val:"trim"`
+	Legacy legacyText       `val:"trim"`
+	Email  sql.NullString   `val:"present"`
+}
+
+func unwrapTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := derefTag(t)
+	MustRegisterDirective(tag, &positive{})
+	MustRegisterUnwrapper(tag, func(w *legacyText) (any, bool) { return &w.Text, w.Valid })
+	return tag
+}
+
+func TestUnwrap_WritesBackIntoWrapper(t *testing.T) {
+	tag := unwrapTag(t)
+
+	r := row{
+		Name:   sql.NullString{String: "  ann ", Valid: true},
+		Count:  sql.NullInt64{Int64: 3, Valid: true},
+		Alias:  sql.Null[string]{V: " a ", Valid: true},
+		Nick:   optional[string]{Val: " n ", Set: true},
+		Legacy: legacyText{Text: " l ", Valid: true},
+		Email:  sql.NullString{String: "a@b", Valid: true},
+	}
+	if err := tag.ProcessStruct(&r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Name.String != "ann" || r.Alias.V != "a" || r.Nick.Val != "n" || r.Legacy.Text != "l" {
+		t.Errorf("MutMode should write into the wrappers: %+v", r)
+	}
+
+	r.Count.Int64 = -1
+	var pe *ProcessError
+	if err := tag.ProcessStruct(&r); !errors.As(err, &pe) || pe.FieldPath != "Count" {
+		t.Errorf("want failure at Count, got %v", err)
+	}
+}
+
+// A wrapper held by value in an interface or a map can be read but not
+// written: MutMode fails rather than losing its result.
+func TestUnwrap_NotAddressable(t *testing.T) {
+	u, _, ok := unwrapTag(t).unwrapperFor(reflect.TypeFor[sql.NullString]())
+	if !ok {
+		t.Fatal("no unwrapper for sql.NullString")
+	}
+	trim := unwrapDirective{anyDirective: directiveWrapper[string]{Directive: &trimDirective{}}, unwrap: u}
+	length := unwrapDirective{anyDirective: directiveWrapper[string]{Directive: &LengthDirective{Min: 1, Max: 3}}, unwrap: u}
+
+	var held any = sql.NullString{String: " a ", Valid: true}
+	m := map[string]sql.NullString{"k": {String: " a ", Valid: true}}
+	for _, val := range []reflect.Value{reflect.ValueOf(held), reflect.ValueOf(m).MapIndex(reflect.ValueOf("k"))} {
+		var fe *FieldSetError
+		if err := trim.HandleAny(val); !errors.As(err, &fe) {
+			t.Errorf("MutMode: want a *FieldSetError, got %v", err)
+		}
+		if err := length.HandleAny(val); err != nil {
+			t.Errorf("EvalMode: unexpected error: %v", err)
+		}
+	}
+}
+
+// An unset wrapper is skipped like a nil pointer, except by a NilHandler.
+func TestUnwrap_UnsetIsNil(t *testing.T) {
+	tag := unwrapTag(t)
+
+	r := row{Name: sql.NullString{String: " x "}, Count: sql.NullInt64{Int64: -1}}
+	err := ProcessStructAll(&r, tag)
+	if n := countLeafErrors(err); n != 1 {
+		t.Fatalf("want 1 error, got %d: %v", n, err)
+	}
+	var he *HandleError
+	if !errors.As(err, &he) || he.Error() != "Email is missing" {
+		t.Errorf("want the NilHandler's error, got %v", err)
+	}
+	if r.Name.String != " x " {
+		t.Errorf("an unset wrapper must not be touched, got %q", r.Name.String)
+	}
+}
+
+func TestRegisterUnwrapper_RejectsNonPointer(t *testing.T) {
+	tag := NewTag(valTagKey)
+	err := RegisterUnwrapper(tag, func(w *legacyText) (any, bool) { return w.Text, w.Valid })
+	var ue *UnwrapperError
+	if !errors.As(err, &ue) {
+		t.Errorf("expected *UnwrapperError, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// nonZero is a reflection-level "required".
+type nonZero struct{}
+
+func (d *nonZero) Name() string        { return "required" }
+func (d *nonZero) Mode() DirectiveMode { return EvalMode }
+func (d *nonZero) HandleValue(_ context.Context, val reflect.Value, field FieldInfo) (reflect.Value, error) {
+	if val.IsZero() {
+		return val, fmt.Errorf("%s is required", field.Field.Name)
+	}
+	return val, nil
+}
+
+// lenDirective is "len, max=N" for any kind reflect.Value.Len supports.
+type lenDirective struct {
+	Max int `param:"max"`
+}
+
+func (d *lenDirective) Name() string        { return "len" }
+func (d *lenDirective) Mode() DirectiveMode { return EvalMode }
+func (d *lenDirective) HandleValue(_ context.Context, val reflect.Value, _ FieldInfo) (reflect.Value, error) {
+	switch val.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if val.Len() > d.Max {
+			return val, fmt.Errorf("length %d exceeds %d", val.Len(), d.Max)
+		}
+		return val, nil
+	}
+	return val, fmt.Errorf("len does not apply to %v", val.Type())
+}
+
+// resetDirective is a MutMode directive that returns out(val).
+type resetDirective struct {
+	out func(reflect.Value) reflect.Value
+}
+
+func (d *resetDirective) Name() string        { return "reset" }
+func (d *resetDirective) Mode() DirectiveMode { return MutMode }
+func (d *resetDirective) HandleValue(_ context.Context, val reflect.Value, _ FieldInfo) (reflect.Value, error) {
+	return d.out(val), nil
+}
+
+func valueTag(t *testing.T) *Tag {
+	t.Helper()
+	tag := chainTag(t)
+	MustRegisterValueDirective(tag, &nonZero{})
+	MustRegisterValueDirective(tag, &lenDirective{})
+	return tag
+}
+
+func TestValueDirective_AnyKind(t *testing.T) {
+	tag := valueTag(t)
+
+	type form struct {
+		Name  string            `val:"trim;required;len, max=5"`
+		Count int               `val:"required"`
+		Tags  []string          `val:"len, max=2"`
+		Attrs map[string]string `val:"len, max=1"`
+	}
+	ok := form{Name: " ann ", Count: 1, Tags: []string{"a"}, Attrs: map[string]string{"k": "v"}}
+	if err := tag.ProcessStruct(&ok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok.Name != "ann" {
+		t.Errorf("Name = %q, chained trim should have run first", ok.Name)
+	}
+
+	bad := form{Name: "   ", Tags: []string{"a", "b", "c"}, Attrs: map[string]string{"a": "", "b": ""}}
+	err := ProcessStructAll(&bad, tag)
+	if n := countLeafErrors(err); n != 4 {
+		t.Fatalf("want 4 errors, got %d: %v", n, err)
+	}
+	var he *HandleError
+	if !errors.As(err, &he) || he.Error() != "Name is required" {
+		t.Errorf("first error = %v", err)
+	}
+}
+
+func TestValueDirective_MutModeWriteBack(t *testing.T) {
+	type rec struct {
+		N int `val:"reset"`
+	}
+
+	tag := NewTag(valTagKey)
+	MustRegisterValueDirective(tag, &resetDirective{out: func(v reflect.Value) reflect.Value {
+		return reflect.Zero(v.Type())
+	}})
+	r := rec{N: 7}
+	if err := tag.ProcessStruct(&r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.N != 0 {
+		t.Errorf("N = %d, want 0", r.N)
+	}
+
+	// A result of the wrong type is refused, not panicked on.
+	tag = NewTag(valTagKey)
+	MustRegisterValueDirective(tag, &resetDirective{out: func(reflect.Value) reflect.Value {
+		return reflect.ValueOf("seven")
+	}})
+	var tm *TypeMismatchError
+	if err := tag.ProcessStruct(&rec{N: 7}); !errors.As(err, &tm) {
+		t.Errorf("expected *TypeMismatchError, got %v", err)
+	}
+
+	tag = NewTag(valTagKey)
+	MustRegisterValueDirective(tag, &resetDirective{out: func(reflect.Value) reflect.Value {
+		return reflect.Value{}
+	}})
+	var fs *FieldSetError
+	if err := tag.ProcessStruct(&rec{N: 7}); !errors.As(err, &fs) {
+		t.Errorf("expected *FieldSetError, got %v", err)
+	}
+}
+
+// A ValueDirective sharing a name with typed overloads handles the rest.
+func TestValueDirective_FallbackOverload(t *testing.T) {
+	tag := sizeTag(t)
+	if err := RegisterValueDirective(tag, &sizeValue{}); err != nil {
+		t.Fatalf("register alongside typed overloads: %v", err)
+	}
+	var dup *DuplicateDirectiveError
+	if err := RegisterValueDirective(tag, &sizeValue{}); !errors.As(err, &dup) {
+		t.Errorf("second ValueDirective: expected *DuplicateDirectiveError, got %v", err)
+	}
+
+	type mixed struct {
+		Name  string  `val:"size, max=1"`
+		Score float64 `val:"size, max=1"`
+		Any   any     `val:"size, max=1"`
+	}
+	m := mixed{Name: "ab", Score: 3, Any: 2.5}
+	err := ProcessStructAll(&m, tag)
+	if n := countLeafErrors(err); n != 3 {
+		t.Fatalf("want 3 errors, got %d: %v", n, err)
+	}
+	var he *HandleError
+	errs := err.(interface{ Unwrap() []error }).Unwrap()
+	if !errors.As(errs[0], &he) || he.Error() != "size 2 exceeds 1" {
+		t.Errorf("Name should use the string overload, got %v", errs[0])
+	}
+	for _, e := range errs[1:] {
+		if !errors.As(e, &he) || he.Error() != "value too large" {
+			t.Errorf("expected the ValueDirective fallback, got %v", e)
+		}
+	}
+}
+
+type sizeValue struct {
+	Max float64 `param:"max"`
+}
+
+func (d *sizeValue) Name() string        { return "size" }
+func (d *sizeValue) Mode() DirectiveMode { return EvalMode }
+func (d *sizeValue) HandleValue(_ context.Context, val reflect.Value, _ FieldInfo) (reflect.Value, error) {
+	for val.Kind() == reflect.Interface {
+		val = val.Elem()
+	}
+	if val.Kind() == reflect.Float64 && val.Float() > d.Max {
+		return val, errors.New("value too large")
+	}
+	return val, nil
+}
@@ -0,0 +1,119 @@
+package tagex
+
+import (
+	"context"
+	"maps"
+	"strings"
+)
+
+// This file implements variables: ${name} references in param values written
+// in a tag, resolved when the params are applied from variables set on the Tag
+// or passed with the call. ProcessParams leaves values as they are;
+// ProcessParamsContext opts in.
+//
+//	tag.SetVariable("maxNameLen", "64")
+//	// val:"length, min=1, max=${maxNameLen}"  -> max=64
+//	ctx = tagex.WithVariables(ctx, map[string]string{"maxNameLen": "32"})
+//	// tag.ProcessStructContext(ctx, &v)        -> max=32
+//
+// A reference may be all of a value or part of it (prefix-${name}), and the
+// substituted text is used as is. $$ is a literal $, the way '' is a literal
+// quote inside a quoted value, and a $ followed by anything else is literal
+// too. A segment whose args use variables is compiled when it runs rather
+// than once per struct type, so its param errors surface on each call.
+
+// SetVariable sets the variable name to value on t, for ${name} references in
+// param values. Variables passed with a call through WithVariables take
+// precedence.
+func (t *Tag) SetVariable(name, value string) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	// Compiled plans hold the map they were compiled with, so replace it
+	// rather than writing to it.
+	vars := maps.Clone(t.variables)
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	vars[name] = value
+	t.variables = vars
+	t.resetPlans()
+}
+
+type variablesKey struct{}
+
+// WithVariables returns a copy of ctx carrying vars for ${name} references in
+// param values, for the ProcessStructContext family and ProcessParamsContext.
+// They take precedence over variables set on the Tag and over those of an
+// enclosing WithVariables.
+func WithVariables(ctx context.Context, vars map[string]string) context.Context {
+	return context.WithValue(ctx, variablesKey{}, mergeVariables(variablesFrom(ctx), vars))
+}
+
+func variablesFrom(ctx context.Context) map[string]string {
+	vars, _ := ctx.Value(variablesKey{}).(map[string]string)
+	return vars
+}
+
+// mergeVariables returns base with over laid on top, without modifying
+// either.
+func mergeVariables(base, over map[string]string) map[string]string {
+	if len(over) == 0 {
+		return base
+	}
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = make(map[string]string, len(over))
+	}
+	maps.Copy(merged, over)
+	return merged
+}
+
+// usesVariables reports whether any arg value refers to a variable.
+func usesVariables(args []Arg) bool {
+	for _, a := range args {
+		for i := 0; i < len(a.Value)-1; i++ {
+			switch {
+			case a.Value[i] != '$':
+			case a.Value[i+1] == '$':
+				i++
+			case a.Value[i+1] == '{' && strings.IndexByte(a.Value[i:], '}') > 0:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveVariables substitutes vars into raw, the value given for the param
+// named param, and unescapes $$. A reference to a variable vars lacks is an
+// *UnknownVariableError.
+func resolveVariables(raw, param string, vars map[string]string) (string, error) {
+	if !strings.Contains(raw, "$") {
+		return raw, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c == '$' && i+1 < len(raw) {
+			switch raw[i+1] {
+			case '$':
+				i++
+			case '{':
+				end := strings.IndexByte(raw[i:], '}')
+				if end < 0 {
+					break
+				}
+				name := strings.TrimSpace(raw[i+2 : i+end])
+				v, ok := vars[name]
+				if !ok {
+					return "", &UnknownVariableError{Name: name, Param: param}
+				}
+				b.WriteString(v)
+				i += end
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,145 @@
+package tagex
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	tag := chainTag(t)
+	tag.SetVariable("maxLen", "3")
+	type form struct {
+		S string `val:"length, min=1, max=${maxLen}"`
+	}
+	if err := tag.ProcessStruct(&form{S: "abc"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tag.ProcessStruct(&form{S: "abcd"}); err == nil {
+		t.Fatal("want abcd to fail max=3")
+	}
+
+	// A call's variables override the Tag's, for that call only.
+	ctx := WithVariables(context.Background(), map[string]string{"maxLen": "5"})
+	if err := tag.ProcessStructContext(ctx, &form{S: "abcd"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tag.ProcessStruct(&form{S: "abcd"}); err == nil {
+		t.Fatal("want the Tag's max=3 back without the call's variables")
+	}
+
+	// Setting a variable after a call takes effect on the next.
+	tag.SetVariable("maxLen", "4")
+	if err := tag.ProcessStruct(&form{S: "abcd"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestVariables_Unknown(t *testing.T) {
+	type form struct {
+		S string `val:"trim;length, min=1, max=${maxLen}"`
+	}
+	err := chainTag(t).ProcessStruct(&form{S: "a"})
+	var pe *ProcessError
+	if !errors.As(err, &pe) || pe.Stage != StageParam || pe.Param != "max" || pe.FieldPath != "S" {
+		t.Fatalf("want a StageParam failure of param max at S, got %v", err)
+	}
+	var ue *UnknownVariableError
+	if !errors.As(err, &ue) || ue.Name != "maxLen" {
+		t.Fatalf("want an *UnknownVariableError for maxLen, got %v", err)
+	}
+}
+
+func TestResolveVariables(t *testing.T) {
+	vars := map[string]string{"a": "1", "b": "${a}"}
+	tests := []struct {
+		in, want string
+		uses     bool
+	}{
+		{"${a}", "1", true},
+		{"x-${ a }", "x-1", true},
+		{"${b}", "${a}", true}, // substituted text isn't resolved again
+		{"$$", "$", false},
+		{"$${a}", "${a}", false},
+		{"$$$${a}", "$${a}", false},
+		{"cost $5", "cost $5", false},
+		{"${a", "${a", false},
+		{"trailing$", "trailing$", false},
+	}
+	for _, tt := range tests {
+		got, err := resolveVariables(tt.in, "p", vars)
+		if err != nil || got != tt.want {
+			t.Errorf("resolveVariables(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+		if uses := usesVariables([]Arg{{Value: tt.in}}); uses != tt.uses {
+			t.Errorf("usesVariables(%q) = %v, want %v", tt.in, uses, tt.uses)
+		}
+	}
+}
+
+// A macro's own ${name} is its placeholder; a variable reaches it through an
+// arg, or escaped as $${name}.
+func TestVariables_Macro(t *testing.T) {
+	tag := chainTag(t)
+	tag.SetVariable("maxLen", "2")
+	tag.MustRegisterMacro("short", "length, min=1, max=${max}")
+	tag.MustRegisterMacro("tiny", "length, min=1, max=$${maxLen}")
+	type form struct {
+		A string `val:"short, max=${maxLen}"`
+		B string `val:"tiny"`
+	}
+	if err := tag.ProcessStruct(&form{A: "ab", B: "ab"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tag.ProcessStruct(&form{A: "ab", B: "abc"}); err == nil {
+		t.Fatal("want abc to fail max=2")
+	}
+}
+
+// Only ProcessParamsContext opts in to variables; ProcessParams takes a value
+// as it is.
+func TestProcessParamsContext(t *testing.T) {
+	var d LengthDirective
+	args := map[string]string{"min": "${lo}", "max": "10"}
+	ctx := WithVariables(context.Background(), map[string]string{"lo": "4"})
+	if err := ProcessParamsContext(ctx, &d, args); err != nil || d.Min != 4 {
+		t.Fatalf("got Min %d, %v", d.Min, err)
+	}
+	var ue *UnknownVariableError
+	if err := ProcessParamsContext(context.Background(), &d, args); !errors.As(err, &ue) || ue.Param != "min" {
+		t.Fatalf("want an *UnknownVariableError for min, got %v", err)
+	}
+	var ce *ConversionError
+	if err := ProcessParams(&d, args); !errors.As(err, &ce) || ce.Raw != "${lo}" {
+		t.Fatalf("want ${lo} converted as written, got %v", err)
+	}
+
+	var p struct {
+		A string `param:"a"`
+	}
+	if err := ProcessParams(&p, map[string]string{"a": "$${x}"}); err != nil || p.A != "$${x}" {
+		t.Fatalf("ProcessParams: got %q, %v, want $${x} unchanged", p.A, err)
+	}
+	if err := ProcessArgs(&p, []Arg{{Key: "a", Value: "$${x}"}}); err != nil || p.A != "$${x}" {
+		t.Fatalf("ProcessArgs: got %q, %v, want $${x} unchanged", p.A, err)
+	}
+}
+
+// A segment using variables checks its constraints on each call, against the
+// params parsed when it compiled.
+func TestVariables_Constraints(t *testing.T) {
+	tag := constraintTag(t)
+	tag.SetVariable("fill", "0")
+	type form struct {
+		S string `val:"align, side=right, width=4, fill=${fill}, ab"`
+	}
+	f := form{S: "7"}
+	if err := tag.ProcessStruct(&f); err != nil || f.S != "0007" {
+		t.Fatalf("got %q, %v; want 0007", f.S, err)
+	}
+	ctx := WithVariables(context.Background(), map[string]string{"fill": "ab"})
+	var ce *ParamConstraintError
+	if err := tag.ProcessStructContext(ctx, &form{S: "7"}); !errors.As(err, &ce) || ce.Param != "fill" {
+		t.Fatalf("want fill=ab to fail its pattern, got %v", err)
+	}
+}